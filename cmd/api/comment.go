@@ -0,0 +1,315 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/georgie5/productReview/internal/data"
+	"github.com/georgie5/productReview/internal/validator"
+)
+
+// commentInput holds the comment fields a client is allowed to change
+type commentInput struct {
+	Content string `json:"content"`
+}
+
+// readPublishedReview returns the review named in the URL, after sending
+// a 404 when it does not exist or is not published, as only published
+// reviews can be discussed
+func (a *applicationDependencies) readPublishedReview(w http.ResponseWriter, r *http.Request) (*data.Review, bool) {
+	review, ok := a.readReviewParams(w, r)
+	if !ok {
+		return nil, false
+	}
+	if review.Status != data.ReviewStatusApproved {
+		a.notFoundResponse(w, r)
+		return nil, false
+	}
+	return review, true
+}
+
+// readCommentParams returns the review and the comment named in the URL
+func (a *applicationDependencies) readCommentParams(w http.ResponseWriter, r *http.Request) (*data.Review, *data.Comment, bool) {
+	review, ok := a.readPublishedReview(w, r)
+	if !ok {
+		return nil, nil, false
+	}
+
+	commentID, err := a.readIDParam(r, "comment_id")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return nil, nil, false
+	}
+
+	comment, err := a.commentModel.Get(review.ID, commentID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return nil, nil, false
+	}
+
+	return review, comment, true
+}
+
+// createCommentHandler adds a comment to a review, or a reply to another
+// comment when parent_id is given
+func (a *applicationDependencies) createCommentHandler(w http.ResponseWriter, r *http.Request) {
+	review, ok := a.readPublishedReview(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Content  string `json:"content"`
+		ParentID *int64 `json:"parent_id"`
+	}
+
+	err := a.readJSON(w, r, &input)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	comment := &data.Comment{
+		ReviewID: review.ID,
+		Content:  input.Content,
+		Status:   data.ReviewStatusApproved,
+	}
+
+	v := validator.New()
+	data.ValidateComment(v, comment)
+
+	// a reply sits one level below its parent
+	if input.ParentID != nil {
+		parent, err := a.commentModel.GetByID(*input.ParentID)
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("parent_id", "must be an existing comment")
+		case err != nil:
+			a.serverErrorResponse(w, r, err)
+			return
+		default:
+			data.ValidateReply(v, comment, parent, a.config.comments.maxDepth)
+			comment.ParentID = &parent.ID
+			comment.Depth = parent.Depth + 1
+		}
+	}
+
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// comments follow the moderation rules of the product's reviews
+	product, err := a.productModel.Get(review.ProductID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	if a.moderationRequired(product) {
+		comment.Status = data.ReviewStatusPending
+	}
+	if !a.screenComment(w, r, comment) {
+		return
+	}
+
+	err = a.commentModel.Insert(comment)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/products/%d/reviews/%d/comments/%d", review.ProductID, review.ID, comment.ID))
+
+	data := envelope{"comment": comment}
+	err = a.writeJSON(w, r, http.StatusCreated, data, headers)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) displayCommentHandler(w http.ResponseWriter, r *http.Request) {
+	_, comment, ok := a.readCommentParams(w, r)
+	if !ok {
+		return
+	}
+
+	// comments are only public once published
+	if comment.Status != data.ReviewStatusApproved {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	data := envelope{"comment": comment}
+	err := a.writeJSON(w, r, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateCommentHandler changes the content of a comment, which goes back
+// through screening and, if required, moderation
+func (a *applicationDependencies) updateCommentHandler(w http.ResponseWriter, r *http.Request) {
+	review, comment, ok := a.readCommentParams(w, r)
+	if !ok {
+		return
+	}
+	original := *comment
+
+	switch a.requestMediaType(r) {
+	case "application/json":
+		var input struct {
+			Content *string `json:"content"`
+		}
+
+		err := a.readJSON(w, r, &input)
+		if err != nil {
+			a.badRequestResponse(w, r, err)
+			return
+		}
+
+		if input.Content != nil {
+			comment.Content = *input.Content
+		}
+	case mergePatchMediaType, jsonPatchMediaType:
+		input := commentInput{Content: comment.Content}
+
+		err := a.readPatch(w, r, &input)
+		if err != nil {
+			switch {
+			case errors.Is(err, errPatchTestFailed):
+				a.conflictResponse(w, r, err)
+			default:
+				a.badRequestResponse(w, r, err)
+			}
+			return
+		}
+
+		comment.Content = input.Content
+	default:
+		a.unsupportedMediaTypeResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	data.ValidateComment(v, comment)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if comment.Content != original.Content {
+		product, err := a.productModel.Get(review.ProductID)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+		if a.moderationRequired(product) || comment.Status == data.ReviewStatusRejected {
+			comment.Status = data.ReviewStatusPending
+			comment.RejectionReason = ""
+		}
+		if !a.screenComment(w, r, comment) {
+			return
+		}
+	}
+
+	err := a.commentModel.Update(comment)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			a.editConflictResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{"comment": comment}
+	err = a.writeJSON(w, r, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteCommentHandler removes a comment and the replies under it
+func (a *applicationDependencies) deleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	review, comment, ok := a.readCommentParams(w, r)
+	if !ok {
+		return
+	}
+
+	err := a.commentModel.Delete(review.ID, comment.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"message": "comment successfully deleted",
+	}
+	err = a.writeJSON(w, r, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// listCommentsHandler lists the published comments of a review, or only
+// the replies to one comment with ?parent_id=
+func (a *applicationDependencies) listCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	review, ok := a.readPublishedReview(w, r)
+	if !ok {
+		return
+	}
+
+	var queryParametersData struct {
+		ParentID *int64
+		data.Filters
+	}
+
+	v := validator.New()
+	query := r.URL.Query()
+	if query.Has("parent_id") {
+		parentID := int64(a.getSingleIntegerParameter(query, "parent_id", 0, v))
+		v.Check(parentID > 0, "parent_id", "must be greater than zero")
+		queryParametersData.ParentID = &parentID
+	}
+
+	queryParametersData.Filters.Page = a.getSingleIntegerParameter(query, "page", 1, v)
+	queryParametersData.Filters.PageSize = a.getSingleIntegerParameter(query, "page_size", 20, v)
+	queryParametersData.Filters.Sort = a.getSingleQueryParameter(query, "sort", "id")
+	queryParametersData.Filters.SortSafeList = []string{"id", "depth", "-id", "-depth"}
+
+	data.ValidateFilters(v, queryParametersData.Filters)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	comments, metadata, err := a.commentModel.GetAllForReview(review.ID, queryParametersData.ParentID, queryParametersData.Filters)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	links, headers := a.paginate(r, metadata)
+	responseData := envelope{
+		"comments":  comments,
+		"@metadata": metadata,
+		"links":     links,
+	}
+	err = a.writeJSON(w, r, http.StatusOK, responseData, headers)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Content types that are already compressed, or too small to be worth it
+var incompressibleTypes = []string{
+	"image/",
+	"video/",
+	"audio/",
+	"font/woff",
+	"application/zip",
+	"application/gzip",
+	"application/x-gzip",
+	"application/zstd",
+	"application/octet-stream",
+}
+
+var (
+	gzipWriters = sync.Pool{New: func() any { return gzip.NewWriter(io.Discard) }}
+	zlibWriters = sync.Pool{New: func() any { return zlib.NewWriter(io.Discard) }}
+)
+
+// compress sends the response with gzip or deflate when the client
+// accepts it, the body is at least -compression-min-bytes long and its
+// type is not compressed already
+func (a *applicationDependencies) compress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.config.compression.minBytes <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// caches must keep the compressed and plain responses apart
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{
+			wrapped:    w,
+			encoding:   encoding,
+			minBytes:   a.config.compression.minBytes,
+			statusCode: http.StatusOK,
+		}
+		defer cw.close()
+
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// negotiateEncoding picks gzip or deflate from an Accept-Encoding header,
+// by quality and then preferring gzip. It returns "" for no compression.
+func negotiateEncoding(header string) string {
+	qualities := make(map[string]float64)
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		quality := 1.0
+		params = strings.TrimSpace(params)
+		if value, ok := strings.CutPrefix(params, "q="); ok {
+			q, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			quality = q
+		}
+		qualities[name] = quality
+	}
+
+	best, bestQuality := "", 0.0
+	for _, encoding := range []string{"gzip", "deflate"} {
+		quality, ok := qualities[encoding]
+		if !ok {
+			quality, ok = qualities["*"]
+		}
+		if ok && quality > bestQuality {
+			best, bestQuality = encoding, quality
+		}
+	}
+	return best
+}
+
+func isCompressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = contentType
+	}
+	for _, prefix := range incompressibleTypes {
+		if strings.HasPrefix(mediaType, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// compressWriter holds back the body until it knows whether the response
+// is large enough to compress, then either compresses everything written
+// or passes it through
+type compressWriter struct {
+	wrapped    http.ResponseWriter
+	encoding   string
+	minBytes   int
+	statusCode int
+
+	headerWritten bool   // WriteHeader was called by the handler
+	decided       bool   // the status and headers were sent on
+	buffer        []byte // body held back until decided
+	encoder       io.WriteCloser
+}
+
+func (cw *compressWriter) Header() http.Header {
+	return cw.wrapped.Header()
+}
+
+func (cw *compressWriter) WriteHeader(statusCode int) {
+	if cw.headerWritten || cw.decided {
+		return
+	}
+	// informational responses go straight through
+	if statusCode >= 100 && statusCode < 200 {
+		cw.wrapped.WriteHeader(statusCode)
+		return
+	}
+	cw.statusCode = statusCode
+	cw.headerWritten = true
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.decided {
+		cw.buffer = append(cw.buffer, b...)
+		if len(cw.buffer) < cw.minBytes {
+			return len(b), nil
+		}
+		err := cw.decide()
+		if err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+
+	if cw.encoder != nil {
+		return cw.encoder.Write(b)
+	}
+	return cw.wrapped.Write(b)
+}
+
+// decide sends the headers, compressed or not, and the body held back
+func (cw *compressWriter) decide() error {
+	cw.decided = true
+	header := cw.wrapped.Header()
+
+	if header.Get("Content-Type") == "" && len(cw.buffer) > 0 {
+		header.Set("Content-Type", http.DetectContentType(cw.buffer))
+	}
+
+	compress := len(cw.buffer) >= cw.minBytes &&
+		header.Get("Content-Encoding") == "" &&
+		cw.statusCode != http.StatusNoContent &&
+		cw.statusCode != http.StatusNotModified &&
+		isCompressible(header.Get("Content-Type"))
+
+	if compress {
+		header.Set("Content-Encoding", cw.encoding)
+		header.Del("Content-Length")
+		// the strong validator no longer matches the bytes sent
+		if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			header.Set("ETag", "W/"+etag)
+		}
+		cw.encoder = newEncoder(cw.encoding, cw.wrapped)
+	}
+
+	cw.wrapped.WriteHeader(cw.statusCode)
+
+	buffer := cw.buffer
+	cw.buffer = nil
+	if len(buffer) == 0 {
+		return nil
+	}
+	var err error
+	if cw.encoder != nil {
+		_, err = cw.encoder.Write(buffer)
+	} else {
+		_, err = cw.wrapped.Write(buffer)
+	}
+	return err
+}
+
+// close sends a response that stayed under the threshold, or finishes the
+// compressed stream
+func (cw *compressWriter) close() {
+	if !cw.decided {
+		cw.decide()
+	}
+	if cw.encoder != nil {
+		cw.encoder.Close()
+		releaseEncoder(cw.encoding, cw.encoder)
+		cw.encoder = nil
+	}
+}
+
+// Flush sends what was written so far, which means deciding on the
+// compression without waiting for the threshold
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		cw.decide()
+	}
+	switch e := cw.encoder.(type) {
+	case *gzip.Writer:
+		e.Flush()
+	case *zlib.Writer:
+		e.Flush()
+	}
+	http.NewResponseController(cw.wrapped).Flush()
+}
+
+// Hijack is only possible before anything was sent
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	cw.decided = true
+	return http.NewResponseController(cw.wrapped).Hijack()
+}
+
+// Unwrap lets http.ResponseController reach the original writer
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.wrapped
+}
+
+func newEncoder(encoding string, w io.Writer) io.WriteCloser {
+	if encoding == "gzip" {
+		gz := gzipWriters.Get().(*gzip.Writer)
+		gz.Reset(w)
+		return gz
+	}
+	// the deflate content coding is the zlib format, not raw deflate
+	zl := zlibWriters.Get().(*zlib.Writer)
+	zl.Reset(w)
+	return zl
+}
+
+func releaseEncoder(encoding string, encoder io.WriteCloser) {
+	if encoding == "gzip" {
+		gzipWriters.Put(encoder)
+		return
+	}
+	zlibWriters.Put(encoder)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", ""},
+		{"gzip", "gzip"},
+		{"deflate", "deflate"},
+		{"br", ""},
+		{"gzip, deflate, br", "gzip"},
+		{"deflate, gzip", "gzip"},
+		{"gzip;q=0.5, deflate", "deflate"},
+		{"gzip;q=0, deflate;q=0", ""},
+		{"GZIP", "gzip"},
+		{"*", "gzip"},
+		{"*;q=0.2, gzip;q=0", "deflate"},
+		{"identity", ""},
+		{"gzip;q=abc", ""},
+	}
+
+	for _, tt := range tests {
+		if got := negotiateEncoding(tt.header); got != tt.want {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestIsCompressible(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        bool
+	}{
+		{"application/json", true},
+		{"text/plain; charset=utf-8", true},
+		{"image/jpeg", false},
+		{"application/zip", false},
+		{"font/woff2", false},
+		{"application/octet-stream", false},
+	}
+
+	for _, tt := range tests {
+		if got := isCompressible(tt.contentType); got != tt.want {
+			t.Errorf("isCompressible(%q) = %t, want %t", tt.contentType, got, tt.want)
+		}
+	}
+}
+
+func TestCompress(t *testing.T) {
+	large := strings.Repeat(`{"name": "kettle"}`, 100)
+
+	tests := []struct {
+		name           string
+		minBytes       int
+		acceptEncoding string
+		contentType    string
+		status         int
+		body           string
+		want           string // the Content-Encoding
+	}{
+		{name: "large body", minBytes: 1024, acceptEncoding: "gzip", body: large, want: "gzip"},
+		{name: "deflate", minBytes: 1024, acceptEncoding: "deflate", body: large, want: "deflate"},
+		{name: "under the threshold", minBytes: 1024, acceptEncoding: "gzip", body: `{"id": 1}`},
+		{name: "at the threshold", minBytes: len(large), acceptEncoding: "gzip", body: large, want: "gzip"},
+		{name: "one byte under the threshold", minBytes: len(large) + 1, acceptEncoding: "gzip", body: large},
+		{name: "client without compression", minBytes: 1024, body: large},
+		{name: "compression disabled", minBytes: 0, acceptEncoding: "gzip", body: large},
+		{name: "image", minBytes: 1024, acceptEncoding: "gzip", contentType: "image/png", body: large},
+		{name: "error response", minBytes: 1024, acceptEncoding: "gzip", status: http.StatusUnprocessableEntity, body: large, want: "gzip"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &applicationDependencies{}
+			a.config.compression.minBytes = tt.minBytes
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				contentType := tt.contentType
+				if contentType == "" {
+					contentType = "application/json"
+				}
+				w.Header().Set("Content-Type", contentType)
+				if tt.status != 0 {
+					w.WriteHeader(tt.status)
+				}
+				// written in small pieces, as a handler may
+				for i := 0; i < len(tt.body); i += 100 {
+					io.WriteString(w, tt.body[i:min(i+100, len(tt.body))])
+				}
+			})
+
+			r := httptest.NewRequest(http.MethodGet, "/v1/products", nil)
+			if tt.acceptEncoding != "" {
+				r.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			w := httptest.NewRecorder()
+			a.compress(next).ServeHTTP(w, r)
+
+			if want := max(tt.status, http.StatusOK); w.Code != want {
+				t.Errorf("status %d, want %d", w.Code, want)
+			}
+			if got := w.Header().Get("Content-Encoding"); got != tt.want {
+				t.Fatalf("Content-Encoding = %q, want %q", got, tt.want)
+			}
+
+			var body io.Reader = w.Body
+			switch tt.want {
+			case "gzip":
+				gz, err := gzip.NewReader(w.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body = gz
+			case "deflate":
+				zl, err := zlib.NewReader(w.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body = zl
+			}
+			got, err := io.ReadAll(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.body {
+				t.Errorf("body of %d bytes differs from the %d bytes written", len(got), len(tt.body))
+			}
+		})
+	}
+}
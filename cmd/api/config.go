@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// The prefix of the environment variables that hold settings. The rest
+// of the name is the flag name in upper case, with - replaced by _, so
+// -db-dsn is read from PRODUCTREVIEW_DB_DSN.
+const envPrefix = "PRODUCTREVIEW_"
+
+// The settings that must not be printed as they are
+var secretSettings = map[string]bool{
+	"db-dsn":         true,
+	"admin-token":    true,
+	"reports-secret": true,
+}
+
+// stringList is a flag.Value holding space separated values
+type stringList []string
+
+func (l *stringList) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, " ")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = strings.Fields(value)
+	return nil
+}
+
+// prefixList is a flag.Value holding space separated IP addresses and
+// CIDR ranges. A single address is stored as a range of one address.
+type prefixList []netip.Prefix
+
+func (l *prefixList) String() string {
+	if l == nil {
+		return ""
+	}
+	values := make([]string, len(*l))
+	for i, prefix := range *l {
+		values[i] = prefix.String()
+	}
+	return strings.Join(values, " ")
+}
+
+func (l *prefixList) Set(value string) error {
+	var prefixes []netip.Prefix
+	for _, field := range strings.Fields(value) {
+		prefix, err := netip.ParsePrefix(field)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(field)
+			if addrErr != nil {
+				return err
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	*l = prefixes
+	return nil
+}
+
+// envName returns the environment variable that holds a flag's value
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// loadConfig fills in the flags that were not given on the command line
+// from the PRODUCTREVIEW_* environment variables, and then from the
+// config file. A flag on the command line wins over an environment
+// variable, which wins over the config file.
+func loadConfig(fs *flag.FlagSet, configPath string) error {
+
+	setOnCommandLine := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		setOnCommandLine[f.Name] = true
+	})
+
+	fileValues := make(map[string]string)
+	if configPath != "" {
+		var err error
+		fileValues, err = readConfigFile(configPath)
+		if err != nil {
+			return err
+		}
+		for name := range fileValues {
+			if fs.Lookup(name) == nil {
+				return fmt.Errorf("%s: unknown setting %q", configPath, name)
+			}
+		}
+	}
+
+	var errs []error
+	fs.VisitAll(func(f *flag.Flag) {
+		if setOnCommandLine[f.Name] {
+			return
+		}
+
+		value, ok := os.LookupEnv(envName(f.Name))
+		source := envName(f.Name)
+		if !ok {
+			value, ok = fileValues[f.Name]
+			source = configPath
+		}
+		if !ok {
+			return
+		}
+
+		err := fs.Set(f.Name, value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid value %q for %s (from %s): %w", value, f.Name, source, err))
+		}
+	})
+
+	return errors.Join(errs...)
+}
+
+// readConfigFile reads the settings of a config file. Files ending in
+// .json hold a JSON object, any other file holds "key = value" or
+// "key: value" lines. Keys are flag names, and [section] headers or
+// nested objects prefix the keys inside them, so "max-open-conns" in a
+// [db] section sets -db-max-open-conns.
+func readConfigFile(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		return readJSONConfig(file, path)
+	}
+	return readKeyValueConfig(file, path)
+}
+
+func readJSONConfig(r io.Reader, path string) (map[string]string, error) {
+	var document map[string]any
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	err := dec.Decode(&document)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	values := make(map[string]string)
+	var flatten func(prefix string, object map[string]any) error
+	flatten = func(prefix string, object map[string]any) error {
+		for key, value := range object {
+			name := prefix + normalizeConfigKey(key)
+			switch v := value.(type) {
+			case map[string]any:
+				err := flatten(name+"-", v)
+				if err != nil {
+					return err
+				}
+			case []any:
+				items := make([]string, len(v))
+				for i, item := range v {
+					items[i] = fmt.Sprint(item)
+				}
+				values[name] = strings.Join(items, " ")
+			case nil:
+				return fmt.Errorf("%s: setting %q must not be null", path, name)
+			default:
+				values[name] = fmt.Sprint(v)
+			}
+		}
+		return nil
+	}
+
+	err = flatten("", document)
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+func readKeyValueConfig(r io.Reader, path string) (map[string]string, error) {
+	values := make(map[string]string)
+	section := ""
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		indented := strings.HasPrefix(text, " ") || strings.HasPrefix(text, "\t")
+		text = strings.TrimSpace(text)
+
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		// TOML style section
+		if strings.HasPrefix(text, "[") && strings.HasSuffix(text, "]") {
+			section = normalizeConfigKey(strings.TrimSpace(text[1:len(text)-1])) + "-"
+			continue
+		}
+
+		separator := strings.IndexAny(text, "=:")
+		if separator < 1 {
+			return nil, fmt.Errorf("%s:%d: expected key = value", path, line)
+		}
+		key := normalizeConfigKey(strings.TrimSpace(text[:separator]))
+		value := strings.TrimSpace(text[separator+1:])
+
+		// YAML style section: a key without a value, followed by
+		// indented keys
+		if value == "" && !indented && text[separator] == ':' {
+			section = key + "-"
+			continue
+		}
+		if !indented && text[separator] == ':' {
+			section = ""
+		}
+
+		// drop a trailing comment and the quotes around the value
+		if !strings.HasPrefix(value, `"`) && !strings.HasPrefix(value, "'") {
+			if comment := strings.Index(value, " #"); comment >= 0 {
+				value = strings.TrimSpace(value[:comment])
+			}
+		}
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		} else if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+			value = value[1 : len(value)-1]
+		}
+
+		values[section+key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+// normalizeConfigKey lets config files use snake_case keys
+func normalizeConfigKey(key string) string {
+	return strings.ToLower(strings.ReplaceAll(key, "_", "-"))
+}
+
+// validateConfig checks the settings once every source has been merged
+func validateConfig(settings serverConfig) error {
+	var errs []error
+	check := func(ok bool, message string) {
+		if !ok {
+			errs = append(errs, errors.New(message))
+		}
+	}
+
+	check(settings.port > 0 && settings.port <= 65535, "port must be between 1 and 65535")
+	check(settings.environment == "development" || settings.environment == "staging" || settings.environment == "production",
+		"env must be development, staging or production")
+	check(settings.drainDelay >= 0, "shutdown-drain-delay must not be negative")
+
+	check(settings.db.dsn != "", "db-dsn must be provided")
+	check(settings.db.maxOpenConns >= 0, "db-max-open-conns must not be negative")
+	check(settings.db.maxIdleConns >= 0, "db-max-idle-conns must not be negative")
+	check(settings.db.maxOpenConns == 0 || settings.db.maxIdleConns <= settings.db.maxOpenConns,
+		"db-max-idle-conns must not be more than db-max-open-conns")
+	check(settings.db.maxIdleTime >= 0, "db-max-idle-time must not be negative")
+	check(settings.db.connMaxLifetime >= 0, "db-conn-max-lifetime must not be negative")
+
+	check(settings.http.idleTimeout > 0, "http-idle-timeout must be greater than zero")
+	check(settings.http.readTimeout > 0, "http-read-timeout must be greater than zero")
+	check(settings.http.writeTimeout > 0, "http-write-timeout must be greater than zero")
+	check(settings.http.shutdownTimeout > 0, "http-shutdown-timeout must be greater than zero")
+	check(settings.maxBodyBytes > 0, "max-body-bytes must be greater than zero")
+	check(settings.compression.minBytes >= 0, "compression-min-bytes must not be negative")
+
+	check(settings.limiter.backend == "memory" || settings.limiter.backend == "postgres", "limiter-backend must be memory or postgres")
+	if settings.limiter.enabled {
+		check(settings.limiter.rps > 0, "limiter-rps must be greater than zero")
+		check(settings.limiter.burst > 0, "limiter-burst must be greater than zero")
+		check(settings.limiter.reviewRPS > 0, "limiter-review-rps must be greater than zero")
+		check(settings.limiter.reviewBurst > 0, "limiter-review-burst must be greater than zero")
+	}
+
+	check(settings.media.dir != "", "media-dir must be provided")
+	check(settings.media.maxBytes > 0, "media-max-bytes must be greater than zero")
+	check(settings.media.maxDimension > 0, "media-max-dimension must be greater than zero")
+	check(settings.media.maxPerReview >= 0, "media-max-per-review must not be negative")
+	check(settings.media.maxPerProduct >= 0, "media-max-per-product must not be negative")
+	check(settings.media.thumbnailSize > 0, "media-thumbnail-size must be greater than zero")
+	check(settings.comments.maxDepth >= 0, "comments-max-depth must not be negative")
+	check(settings.reports.hideThreshold >= 0, "reports-hide-threshold must not be negative")
+	check(settings.reports.secret == "" || len(settings.reports.secret) >= 32, "reports-secret must be at least 32 characters long")
+	check(settings.reports.secret != "" || settings.environment != "production", "reports-secret must be set in production")
+	check(settings.screening.maxLinks >= 0, "screening-max-links must not be negative")
+	check(settings.screening.maxEmoji >= 0, "screening-max-emoji must not be negative")
+
+	check((settings.tls.certFile == "") == (settings.tls.keyFile == ""), "tls-cert and tls-key must be provided together")
+	check(settings.tls.redirectAddr == "" || settings.tls.certFile != "", "tls-redirect-addr requires tls-cert and tls-key")
+	check(settings.tls.reloadInterval > 0, "tls-reload-interval must be greater than zero")
+
+	return errors.Join(errs...)
+}
+
+// printConfig writes the effective value of every setting, hiding the
+// secrets
+func printConfig(w io.Writer, fs *flag.FlagSet) {
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == "config" || f.Name == "print-config" {
+			return
+		}
+		value := f.Value.String()
+		if secretSettings[f.Name] {
+			value = redact(value)
+		}
+		fmt.Fprintf(w, "%s = %q\n", f.Name, value)
+	})
+}
+
+// redact hides the password of a URL, or the whole value otherwise
+func redact(value string) string {
+	if value == "" {
+		return value
+	}
+	u, err := url.Parse(value)
+	if err == nil && u.Scheme != "" && u.User != nil {
+		return u.Redacted()
+	}
+	return "REDACTED"
+}
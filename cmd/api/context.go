@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"net/http"
+)
+
+// contextKey keeps our context keys apart from keys set by other packages
+type contextKey string
+
+const (
+	routeContextKey     = contextKey("route")
+	requestIDContextKey = contextKey("request_id")
+)
+
+// routeHolder lets a route handler report the pattern it was registered
+// with back to the middleware that wraps the router
+type routeHolder struct {
+	pattern string
+}
+
+// contextWithRouteHolder returns a copy of the request that can carry
+// the matched route pattern
+func (a *applicationDependencies) contextWithRouteHolder(r *http.Request) (*http.Request, *routeHolder) {
+	holder := &routeHolder{}
+	ctx := context.WithValue(r.Context(), routeContextKey, holder)
+	return r.WithContext(ctx), holder
+}
+
+// contextSetRoute records the route pattern that matched the request
+func (a *applicationDependencies) contextSetRoute(r *http.Request, pattern string) {
+	holder, ok := r.Context().Value(routeContextKey).(*routeHolder)
+	if ok {
+		holder.pattern = pattern
+	}
+}
+
+// contextGetRoute returns the route pattern that matched the request, or
+// an empty string when no route matched
+func (a *applicationDependencies) contextGetRoute(r *http.Request) string {
+	holder, ok := r.Context().Value(routeContextKey).(*routeHolder)
+	if !ok {
+		return ""
+	}
+	return holder.pattern
+}
+
+// contextSetRequestID returns a copy of the request carrying the request id
+func (a *applicationDependencies) contextSetRequestID(r *http.Request, id string) *http.Request {
+	ctx := context.WithValue(r.Context(), requestIDContextKey, id)
+	return r.WithContext(ctx)
+}
+
+// contextGetRequestID returns the request id, or an empty string if the
+// request did not go through the requestID middleware
+func (a *applicationDependencies) contextGetRequestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDContextKey).(string)
+	return id
+}
@@ -10,7 +10,8 @@ func (a *applicationDependencies) logError(r *http.Request, err error) {
 
 	method := r.Method
 	uri := r.URL.RequestURI()
-	a.logger.Error(err.Error(), "method", method, "uri", uri)
+	requestID := a.contextGetRequestID(r)
+	a.logger.Error(err.Error(), "request_id", requestID, "method", method, "uri", uri)
 
 }
 
@@ -18,7 +19,12 @@ func (a *applicationDependencies) logError(r *http.Request, err error) {
 func (a *applicationDependencies) errorResponseJSON(w http.ResponseWriter, r *http.Request, status int, message any) {
 
 	errorData := envelope{"error": message}
-	err := a.writeJSON(w, status, errorData, nil)
+	// the request id lets the client quote the failed request
+	requestID := a.contextGetRequestID(r)
+	if requestID != "" {
+		errorData["request_id"] = requestID
+	}
+	err := a.writeJSON(w, r, status, errorData, nil)
 	if err != nil {
 		a.logError(r, err)
 		w.WriteHeader(500)
@@ -73,3 +79,38 @@ func (a *applicationDependencies) rateLimitExceededResponse(w http.ResponseWrite
 	message := "rate limit exceeded"
 	a.errorResponseJSON(w, r, http.StatusTooManyRequests, message)
 }
+
+// send an error response if the request body has a media type we cannot handle (415)
+func (a *applicationDependencies) unsupportedMediaTypeResponse(w http.ResponseWriter, r *http.Request) {
+
+	message := fmt.Sprintf("the %q content type is not supported for this resource", r.Header.Get("Content-Type"))
+	a.errorResponseJSON(w, r, http.StatusUnsupportedMediaType, message)
+}
+
+// send an error response if an uploaded file is too large (413)
+func (a *applicationDependencies) contentTooLargeResponse(w http.ResponseWriter, r *http.Request, maxBytes int64) {
+
+	message := fmt.Sprintf("files must not be larger than %d bytes", maxBytes)
+	a.errorResponseJSON(w, r, http.StatusRequestEntityTooLarge, message)
+}
+
+// send an error response if the request lacks a valid Bearer token (401)
+func (a *applicationDependencies) invalidAuthenticationTokenResponse(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	message := "invalid or missing authentication token"
+	a.errorResponseJSON(w, r, http.StatusUnauthorized, message)
+}
+
+// send an error response when the record changed while the request was
+// being handled (409)
+func (a *applicationDependencies) editConflictResponse(w http.ResponseWriter, r *http.Request) {
+	message := "unable to update the record due to an edit conflict, please try again"
+	a.errorResponseJSON(w, r, http.StatusConflict, message)
+}
+
+// send an error response if the request conflicts with the current state of the resource (409)
+func (a *applicationDependencies) conflictResponse(w http.ResponseWriter, r *http.Request, err error) {
+
+	a.errorResponseJSON(w, r, http.StatusConflict, err.Error())
+}
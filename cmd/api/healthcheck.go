@@ -1,7 +1,12 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"time"
+
+	"github.com/georgie5/productReview/internal/data"
 )
 
 func (a *applicationDependencies) healthcheckHandler(w http.ResponseWriter, r *http.Request) {
@@ -13,8 +18,122 @@ func (a *applicationDependencies) healthcheckHandler(w http.ResponseWriter, r *h
 			"version":     appVersion,
 		},
 	}
-	err := a.writeJSON(w, http.StatusOK, data, nil)
+	err := a.writeJSON(w, r, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// livenessHandler only tells that the process is running and serving
+// requests. It never checks dependencies, so a database outage does not
+// get the pod restarted.
+func (a *applicationDependencies) livenessHandler(w http.ResponseWriter, r *http.Request) {
+
+	data := envelope{
+		"status": "alive",
+		"uptime": time.Since(a.startedAt).Round(time.Second).String(),
+	}
+	err := a.writeJSON(w, r, http.StatusOK, data, nil)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 	}
 }
+
+// readinessHandler tells whether the server can handle traffic: the
+// database answers, the schema is at the expected version and the
+// server is not shutting down. It returns 503 when any check fails.
+func (a *applicationDependencies) readinessHandler(w http.ResponseWriter, r *http.Request) {
+
+	ready := true
+	checks := make(map[string]any)
+
+	// ping the database with a short timeout
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	err := a.db.PingContext(ctx)
+	database := map[string]any{
+		"status":  "up",
+		"latency": time.Since(start).String(),
+	}
+	// the error text may describe the database, it is only logged
+	if err != nil {
+		ready = false
+		database["status"] = "down"
+		a.logError(r, err)
+	}
+	checks["database"] = database
+
+	migrations := map[string]any{
+		"status":   "up",
+		"expected": expectedMigrationVersion,
+	}
+	if err == nil {
+		version, dirty, err := data.MigrationVersion(a.db)
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			ready = false
+			migrations["status"] = "down"
+			migrations["error"] = "no migrations have been applied"
+		case err != nil:
+			ready = false
+			migrations["status"] = "down"
+			a.logError(r, err)
+		default:
+			migrations["version"] = version
+			migrations["dirty"] = dirty
+			if !schemaReady(version, dirty) {
+				ready = false
+				migrations["status"] = "down"
+			}
+		}
+	} else {
+		migrations["status"] = "unknown"
+	}
+	checks["migrations"] = migrations
+
+	draining := a.draining.Load()
+	if draining {
+		ready = false
+	}
+
+	status := "ready"
+	statusCode := http.StatusOK
+	if !ready {
+		status = "unavailable"
+		statusCode = http.StatusServiceUnavailable
+	}
+
+	stats := a.db.Stats()
+	data := envelope{
+		"status":   status,
+		"draining": draining,
+		"uptime":   time.Since(a.startedAt).Round(time.Second).String(),
+		"checks":   checks,
+		"database_pool": map[string]any{
+			"max_open_connections": stats.MaxOpenConnections,
+			"open_connections":     stats.OpenConnections,
+			"in_use":               stats.InUse,
+			"idle":                 stats.Idle,
+			"wait_count":           stats.WaitCount,
+			"wait_duration":        stats.WaitDuration.String(),
+		},
+		"system_info": map[string]string{
+			"environment": a.config.environment,
+			"version":     appVersion,
+		},
+	}
+	err = a.writeJSON(w, r, statusCode, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// schemaReady tells whether the expected migrations are applied and the
+// last one completed. A newer schema is fine: during a rolling deploy the
+// database is migrated before the old instances are replaced, and they
+// must keep serving until then.
+func schemaReady(version int64, dirty bool) bool {
+	return !dirty && version >= expectedMigrationVersion
+}
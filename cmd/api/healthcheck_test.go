@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSchemaReady(t *testing.T) {
+	tests := []struct {
+		name    string
+		version int64
+		dirty   bool
+		want    bool
+	}{
+		{"expected version", expectedMigrationVersion, false, true},
+		{"newer schema during a deploy", expectedMigrationVersion + 1, false, true},
+		{"missing migrations", expectedMigrationVersion - 1, false, false},
+		{"failed migration", expectedMigrationVersion, true, false},
+		{"failed newer migration", expectedMigrationVersion + 1, true, false},
+	}
+
+	for _, tt := range tests {
+		if got := schemaReady(tt.version, tt.dirty); got != tt.want {
+			t.Errorf("%s: schemaReady(%d, %t) = %t, want %t", tt.name, tt.version, tt.dirty, got, tt.want)
+		}
+	}
+}
+
+func TestLivenessHandler(t *testing.T) {
+	a := &applicationDependencies{startedAt: time.Now().Add(-time.Minute)}
+
+	w := httptest.NewRecorder()
+	a.livenessHandler(w, httptest.NewRequest(http.MethodGet, "/v1/healthcheck/live", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, want %d", w.Code, http.StatusOK)
+	}
+	var body struct {
+		Status string `json:"status"`
+		Uptime string `json:"uptime"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Status != "alive" || body.Uptime != "1m0s" {
+		t.Errorf("got %+v, want alive for 1m0s", body)
+	}
+}
@@ -5,20 +5,29 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/netip"
 	"net/url"
 	"strconv"
 	"strings"
 
+	"github.com/georgie5/productReview/internal/data"
 	"github.com/georgie5/productReview/internal/validator"
 	"github.com/julienschmidt/httprouter"
 )
 
 type envelope map[string]any
 
-func (a *applicationDependencies) writeJSON(w http.ResponseWriter, status int, data envelope, headers http.Header) error {
+func (a *applicationDependencies) writeJSON(w http.ResponseWriter, r *http.Request, status int, data envelope, headers http.Header) error {
 
-	jsResponse, err := json.MarshalIndent(data, "", "\t")
+	var jsResponse []byte
+	var err error
+	if a.prettyJSON(r) {
+		jsResponse, err = json.MarshalIndent(data, "", "\t")
+	} else {
+		jsResponse, err = json.Marshal(data)
+	}
 	if err != nil {
 		return err
 	}
@@ -42,11 +51,20 @@ func (a *applicationDependencies) writeJSON(w http.ResponseWriter, status int, d
 
 }
 
+// prettyJSON tells whether to indent the JSON response: ?pretty=true or
+// ?pretty=false wins, otherwise it is indented unless -json-compact is set
+func (a *applicationDependencies) prettyJSON(r *http.Request) bool {
+	pretty, err := strconv.ParseBool(r.URL.Query().Get("pretty"))
+	if err != nil {
+		return !a.config.jsonCompact
+	}
+	return pretty
+}
+
 func (a *applicationDependencies) readJSON(w http.ResponseWriter, r *http.Request, destination any) error {
 
-	// what is the max size of the request body (250KB seems reasonable)
-	maxBytes := 256_000
-	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
+	// what is the max size of the request body (-max-body-bytes, 250KB by default)
+	r.Body = http.MaxBytesReader(w, r.Body, a.config.maxBodyBytes)
 	// our decoder will check for unknown fields
 	dec := json.NewDecoder(r.Body)
 	dec.DisallowUnknownFields()
@@ -55,46 +73,7 @@ func (a *applicationDependencies) readJSON(w http.ResponseWriter, r *http.Reques
 
 	// err := json.NewDecoder(r.Body).Decode(destination) // delete this line
 	if err != nil {
-		// check for the different errors
-		var syntaxError *json.SyntaxError
-		var unmarshalTypeError *json.UnmarshalTypeError
-		var invalidUnmarshalError *json.InvalidUnmarshalError
-		var maxBytesError *http.MaxBytesError
-
-		switch {
-		case errors.As(err, &syntaxError):
-			return fmt.Errorf("the body contains badly-formed (at character %d)", syntaxError.Offset)
-			// Decode can also send back an io error message
-		case errors.Is(err, io.ErrUnexpectedEOF):
-			return errors.New("the body contains badly-formed JSON")
-
-		case errors.As(err, &unmarshalTypeError):
-			if unmarshalTypeError.Field != "" {
-				return fmt.Errorf("the body contains the incorrect JSON type for field %q", unmarshalTypeError.Field)
-			}
-			return fmt.Errorf("the body contains the incorrect JSON type (at character %d)", unmarshalTypeError.Offset)
-		case errors.Is(err, io.EOF):
-			return errors.New("the body must not be empty")
-
-		// check for unknown field error
-		case strings.HasPrefix(err.Error(), "json: unknown field "):
-			fieldName := strings.TrimPrefix(err.Error(),
-				"json: unknown field ")
-			return fmt.Errorf("body contains unknown key %s", fieldName)
-
-		// does the body exceed our limit of 250KB?
-		case errors.As(err, &maxBytesError):
-			return fmt.Errorf("the body must not be larger than %d bytes", maxBytesError.Limit)
-		case errors.Is(err, io.EOF):
-			return errors.New("the body must not be empty")
-
-		// the programmer messed up
-		case errors.As(err, &invalidUnmarshalError):
-			panic(err)
-			// some other type of error
-		default:
-			return err
-		}
+		return a.decodeJSONError(err)
 	}
 	// almost done. Let's lastly check if there is any data after
 	// the valid JSON data. Maybe the person is trying to send
@@ -110,6 +89,106 @@ func (a *applicationDependencies) readJSON(w http.ResponseWriter, r *http.Reques
 	return nil
 }
 
+// decodeJSONError turns the errors returned by the JSON decoder into
+// messages that can be sent back to the client
+func (a *applicationDependencies) decodeJSONError(err error) error {
+	// check for the different errors
+	var syntaxError *json.SyntaxError
+	var unmarshalTypeError *json.UnmarshalTypeError
+	var invalidUnmarshalError *json.InvalidUnmarshalError
+	var maxBytesError *http.MaxBytesError
+
+	switch {
+	case errors.As(err, &syntaxError):
+		return fmt.Errorf("the body contains badly-formed (at character %d)", syntaxError.Offset)
+		// Decode can also send back an io error message
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return errors.New("the body contains badly-formed JSON")
+
+	case errors.As(err, &unmarshalTypeError):
+		if unmarshalTypeError.Field != "" {
+			return fmt.Errorf("the body contains the incorrect JSON type for field %q", unmarshalTypeError.Field)
+		}
+		return fmt.Errorf("the body contains the incorrect JSON type (at character %d)", unmarshalTypeError.Offset)
+	case errors.Is(err, io.EOF):
+		return errors.New("the body must not be empty")
+
+	// check for unknown field error
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		fieldName := strings.TrimPrefix(err.Error(),
+			"json: unknown field ")
+		return fmt.Errorf("body contains unknown key %s", fieldName)
+
+	// does the body exceed our limit?
+	case errors.As(err, &maxBytesError):
+		return fmt.Errorf("the body must not be larger than %d bytes", maxBytesError.Limit)
+	case errors.Is(err, io.EOF):
+		return errors.New("the body must not be empty")
+
+	// the programmer messed up
+	case errors.As(err, &invalidUnmarshalError):
+		panic(err)
+		// some other type of error
+	default:
+		return err
+	}
+}
+
+// clientIP returns the IP address of the client that sent the request.
+// When the request comes from one of our trusted proxies the address is
+// taken from X-Forwarded-For, or X-Real-IP, instead.
+func (a *applicationDependencies) clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	if !a.isTrustedProxy(ip) {
+		return ip
+	}
+
+	// Each proxy appends the address it received the request from, so
+	// walk the list from the right and stop at the first address that is
+	// not one of ours. Anything further left could be forged by the client.
+	var forwarded []string
+	for _, value := range r.Header.Values("X-Forwarded-For") {
+		forwarded = append(forwarded, strings.Split(value, ",")...)
+	}
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		candidate := strings.TrimSpace(forwarded[i])
+		if _, err := netip.ParseAddr(candidate); err != nil {
+			break
+		}
+		ip = candidate
+		if !a.isTrustedProxy(candidate) {
+			return ip
+		}
+	}
+	if len(forwarded) > 0 {
+		return ip
+	}
+
+	realIP := strings.TrimSpace(r.Header.Get("X-Real-IP"))
+	if _, err := netip.ParseAddr(realIP); err == nil {
+		return realIP
+	}
+	return ip
+}
+
+// isTrustedProxy checks the address against the -trusted-proxies list
+func (a *applicationDependencies) isTrustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range a.config.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
 func (a *applicationDependencies) readIDParam(r *http.Request, paramName string) (int64, error) {
 	// Get the URL parameters
 	params := httprouter.ParamsFromContext(r.Context())
@@ -142,6 +221,28 @@ func (a *applicationDependencies) getMultipleQueryParameters(queryParameters url
 
 }
 
+// call when we have multiple comma-separated integer values. Like
+// getSingleIntegerParameter it adds a validation error for bad values
+func (a *applicationDependencies) getMultipleIntegerParameters(queryParameters url.Values, key string, defaultValue []int64, v *validator.Validator) []int64 {
+
+	values := a.getMultipleQueryParameters(queryParameters, key, nil)
+	if values == nil {
+		return defaultValue
+	}
+
+	result := make([]int64, 0, len(values))
+	for _, value := range values {
+		intValue, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			v.AddError(key, "must be a comma-separated list of integer values")
+			return defaultValue
+		}
+		result = append(result, intValue)
+	}
+
+	return result
+}
+
 // this method can cause a validation error when trying to convert the
 // string to a valid integer value
 func (a *applicationDependencies) getSingleIntegerParameter(queryParameters url.Values, key string, defaultValue int, v *validator.Validator) int {
@@ -160,3 +261,76 @@ func (a *applicationDependencies) getSingleIntegerParameter(queryParameters url.
 	return intValue
 
 }
+
+// getOptionalBoolParameter returns nil when the parameter is missing, so
+// a filter on it can be left out. It adds a validation error for values
+// other than true or false.
+func (a *applicationDependencies) getOptionalBoolParameter(queryParameters url.Values, key string, v *validator.Validator) *bool {
+
+	result := queryParameters.Get(key)
+	if result == "" {
+		return nil
+	}
+
+	boolValue, err := strconv.ParseBool(result)
+	if err != nil {
+		v.AddError(key, "must be true or false")
+		return nil
+	}
+
+	return &boolValue
+}
+
+// paginationLinks holds the URLs of the pages around the current page
+// of a list response
+type paginationLinks struct {
+	Self  string `json:"self"`
+	First string `json:"first,omitempty"`
+	Prev  string `json:"prev,omitempty"`
+	Next  string `json:"next,omitempty"`
+	Last  string `json:"last,omitempty"`
+}
+
+// paginate builds the links for a list response along with the Link
+// (RFC 8288) and X-Total-Count headers. Every query parameter of the
+// original request is kept, only the page number changes.
+func (a *applicationDependencies) paginate(r *http.Request, metadata data.Metadata) (paginationLinks, http.Header) {
+
+	pageURL := func(page int) string {
+		query := r.URL.Query()
+		query.Set("page", strconv.Itoa(page))
+		return (&url.URL{Path: r.URL.Path, RawQuery: query.Encode()}).String()
+	}
+
+	links := paginationLinks{Self: r.URL.RequestURI()}
+	// an empty result has no pages to link to
+	if metadata.TotalRecords > 0 {
+		links.First = pageURL(metadata.FirstPage)
+		links.Last = pageURL(metadata.LastPage)
+		if metadata.CurrentPage > metadata.FirstPage {
+			links.Prev = pageURL(min(metadata.CurrentPage-1, metadata.LastPage))
+		}
+		if metadata.CurrentPage < metadata.LastPage {
+			links.Next = pageURL(metadata.CurrentPage + 1)
+		}
+	}
+
+	var linkHeader []string
+	for _, link := range []struct{ rel, target string }{
+		{"self", links.Self},
+		{"first", links.First},
+		{"prev", links.Prev},
+		{"next", links.Next},
+		{"last", links.Last},
+	} {
+		if link.target != "" {
+			linkHeader = append(linkHeader, fmt.Sprintf("<%s>; rel=%q", link.target, link.rel))
+		}
+	}
+
+	headers := make(http.Header)
+	headers.Set("Link", strings.Join(linkHeader, ", "))
+	headers.Set("X-Total-Count", strconv.Itoa(metadata.TotalRecords))
+
+	return links, headers
+}
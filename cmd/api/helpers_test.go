@@ -0,0 +1,183 @@
+package main
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/georgie5/productReview/internal/data"
+	"github.com/georgie5/productReview/internal/validator"
+)
+
+func TestPaginate(t *testing.T) {
+	tests := []struct {
+		name     string
+		target   string
+		metadata data.Metadata
+		want     paginationLinks
+		link     string
+	}{
+		{
+			name:   "no records",
+			target: "/v1/products?page=1",
+			want:   paginationLinks{Self: "/v1/products?page=1"},
+			link:   `</v1/products?page=1>; rel="self"`,
+		},
+		{
+			name:     "single page",
+			target:   "/v1/products",
+			metadata: data.Metadata{CurrentPage: 1, PageSize: 10, FirstPage: 1, LastPage: 1, TotalRecords: 3},
+			want:     paginationLinks{Self: "/v1/products", First: "/v1/products?page=1", Last: "/v1/products?page=1"},
+			link:     `</v1/products>; rel="self", </v1/products?page=1>; rel="first", </v1/products?page=1>; rel="last"`,
+		},
+		{
+			name:     "middle page keeps the other parameters",
+			target:   "/v1/products?category=books&page=2&sort=-name",
+			metadata: data.Metadata{CurrentPage: 2, PageSize: 10, FirstPage: 1, LastPage: 3, TotalRecords: 25},
+			want: paginationLinks{
+				Self:  "/v1/products?category=books&page=2&sort=-name",
+				First: "/v1/products?category=books&page=1&sort=-name",
+				Prev:  "/v1/products?category=books&page=1&sort=-name",
+				Next:  "/v1/products?category=books&page=3&sort=-name",
+				Last:  "/v1/products?category=books&page=3&sort=-name",
+			},
+		},
+		{
+			name:     "page past the last one",
+			target:   "/v1/products?page=9",
+			metadata: data.Metadata{CurrentPage: 9, PageSize: 10, FirstPage: 1, LastPage: 3, TotalRecords: 25},
+			want: paginationLinks{
+				Self:  "/v1/products?page=9",
+				First: "/v1/products?page=1",
+				Prev:  "/v1/products?page=3",
+				Last:  "/v1/products?page=3",
+			},
+		},
+	}
+
+	a := &applicationDependencies{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			links, headers := a.paginate(httptest.NewRequest("GET", tt.target, nil), tt.metadata)
+			if links != tt.want {
+				t.Errorf("links = %+v, want %+v", links, tt.want)
+			}
+			if tt.link != "" && headers.Get("Link") != tt.link {
+				t.Errorf("Link = %s, want %s", headers.Get("Link"), tt.link)
+			}
+			if got, want := headers.Get("X-Total-Count"), strconv.Itoa(tt.metadata.TotalRecords); got != want {
+				t.Errorf("X-Total-Count = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestGetMultipleIntegerParameters(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    []int64
+		wantErr bool
+	}{
+		{query: "", want: nil},
+		{query: "ids=7", want: []int64{7}},
+		{query: "ids=1,2,3", want: []int64{1, 2, 3}},
+		{query: "ids=1,%202", want: []int64{1, 2}},
+		{query: "ids=1,two", wantErr: true},
+		{query: "ids=1,,2", wantErr: true},
+	}
+
+	a := &applicationDependencies{}
+	for _, tt := range tests {
+		values, err := url.ParseQuery(tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v := validator.New()
+		got := a.getMultipleIntegerParameters(values, "ids", nil, v)
+		if v.IsEmpty() == tt.wantErr {
+			t.Errorf("%q: errors = %v, want error %t", tt.query, v.Errors, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	a := &applicationDependencies{}
+	err := a.config.trustedProxies.Set("10.0.0.0/8 192.168.1.10 fd00::/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string // X-Forwarded-For headers
+		realIP     string
+		want       string
+	}{
+		{name: "direct client", remoteAddr: "203.0.113.7:5000", want: "203.0.113.7"},
+		{
+			name:       "untrusted peer cannot forward",
+			remoteAddr: "203.0.113.7:5000",
+			forwarded:  []string{"198.51.100.1"},
+			realIP:     "198.51.100.2",
+			want:       "203.0.113.7",
+		},
+		{name: "trusted proxy", remoteAddr: "10.0.0.2:5000", forwarded: []string{"198.51.100.1"}, want: "198.51.100.1"},
+		{
+			name:       "chain of trusted proxies",
+			remoteAddr: "10.0.0.2:5000",
+			forwarded:  []string{"198.51.100.1, 192.168.1.10, 10.1.2.3"},
+			want:       "198.51.100.1",
+		},
+		{
+			// only the address the first trusted proxy saw is believed
+			name:       "forged address left of the client",
+			remoteAddr: "10.0.0.2:5000",
+			forwarded:  []string{"1.2.3.4, 198.51.100.1"},
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "several headers",
+			remoteAddr: "10.0.0.2:5000",
+			forwarded:  []string{"1.2.3.4", "198.51.100.1, 10.0.0.9"},
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "garbage stops the walk",
+			remoteAddr: "10.0.0.2:5000",
+			forwarded:  []string{"198.51.100.1, not-an-ip, 10.0.0.9"},
+			want:       "10.0.0.9",
+		},
+		{
+			name:       "only trusted proxies",
+			remoteAddr: "10.0.0.2:5000",
+			forwarded:  []string{"10.0.0.5"},
+			want:       "10.0.0.5",
+		},
+		{name: "X-Real-IP", remoteAddr: "10.0.0.2:5000", realIP: "198.51.100.1", want: "198.51.100.1"},
+		{name: "invalid X-Real-IP", remoteAddr: "10.0.0.2:5000", realIP: "unknown", want: "10.0.0.2"},
+		{name: "IPv6 proxy", remoteAddr: "[fd00::1]:5000", forwarded: []string{"2001:db8::7"}, want: "2001:db8::7"},
+		{name: "IPv4-mapped proxy", remoteAddr: "[::ffff:10.0.0.2]:5000", forwarded: []string{"198.51.100.1"}, want: "198.51.100.1"},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/v1/products", nil)
+		r.RemoteAddr = tt.remoteAddr
+		for _, value := range tt.forwarded {
+			r.Header.Add("X-Forwarded-For", value)
+		}
+		if tt.realIP != "" {
+			r.Header.Set("X-Real-IP", tt.realIP)
+		}
+
+		if got := a.clientIP(r); got != tt.want {
+			t.Errorf("%s: clientIP = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/georgie5/productReview/internal/data"
+	"github.com/georgie5/productReview/internal/media"
+)
+
+// uploadReviewMediaHandler attaches the photos sent as "file" parts of a
+// multipart/form-data request to a review. The photos are stored without
+// their metadata, next to a thumbnail. New photos change the review like
+// an edit does, so the review goes back to the moderation queue the same
+// way.
+func (a *applicationDependencies) uploadReviewMediaHandler(w http.ResponseWriter, r *http.Request) {
+	review, ok := a.readReviewParams(w, r)
+	if !ok {
+		return
+	}
+
+	product, err := a.productModel.Get(review.ProductID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	count, err := a.mediaModel.CountForReview(review.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	limitMessage := fmt.Sprintf("a review can have at most %d photos", a.config.media.maxPerReview)
+	images, ok := a.readImageUploads(w, r, a.config.media.maxPerReview-count, limitMessage)
+	if !ok {
+		return
+	}
+
+	attached := []*data.ReviewMedia{}
+	for _, img := range images {
+		reviewMedia, err := a.storeReviewMedia(r.Context(), review, img)
+		if err != nil {
+			a.deleteBlobs(data.MediaKeys(attached...)...)
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+		attached = append(attached, reviewMedia)
+	}
+
+	// requeue the review before the photos are recorded, so they are never
+	// published without the moderation the review needs
+	status := review.Status
+	a.requeueReview(review, product)
+	if review.Status != status {
+		err = a.reviewModel.Update(review)
+		if err != nil {
+			a.deleteBlobs(data.MediaKeys(attached...)...)
+			switch {
+			case errors.Is(err, data.ErrEditConflict):
+				a.editConflictResponse(w, r)
+			default:
+				a.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		// a review waiting for a moderator does not count in the rating
+		err = a.productModel.UpdateAverageRating(product.ID)
+		if err != nil {
+			a.deleteBlobs(data.MediaKeys(attached...)...)
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	// the count read above may be stale by now, the limit is enforced
+	// again while the photos are recorded
+	err = a.mediaModel.InsertAll(review.ID, attached, a.config.media.maxPerReview)
+	if err != nil {
+		a.deleteBlobs(data.MediaKeys(attached...)...)
+		switch {
+		case errors.Is(err, data.ErrLimitReached):
+			a.failedValidationResponse(w, r, map[string]string{"file": limitMessage})
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = a.writeJSON(w, r, http.StatusCreated, envelope{"media": attached, "review_status": review.Status}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// readImageUploads reads and decodes the images sent as "file" parts of a
+// multipart/form-data request, at most remaining of them. It returns
+// false, after sending an error response, when the request is rejected.
+func (a *applicationDependencies) readImageUploads(w http.ResponseWriter, r *http.Request, remaining int, limitMessage string) ([]*media.Image, bool) {
+
+	// room for every file the request can still add, plus the headers
+	maxBytes := a.config.media.maxBytes
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes*int64(max(remaining, 1))+1<<20)
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		if errors.Is(err, http.ErrNotMultipart) {
+			a.errorResponseJSON(w, r, http.StatusUnsupportedMediaType, "the request must be multipart/form-data")
+			return nil, false
+		}
+		a.badRequestResponse(w, r, err)
+		return nil, false
+	}
+
+	limits := media.Limits{MaxWidth: a.config.media.maxDimension, MaxHeight: a.config.media.maxDimension}
+	var images []*media.Image
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var maxBytesError *http.MaxBytesError
+			if errors.As(err, &maxBytesError) {
+				a.contentTooLargeResponse(w, r, maxBytes)
+				return nil, false
+			}
+			a.badRequestResponse(w, r, err)
+			return nil, false
+		}
+		if part.FormName() != "file" {
+			part.Close()
+			continue
+		}
+
+		if len(images) >= remaining {
+			a.failedValidationResponse(w, r, map[string]string{"file": limitMessage})
+			return nil, false
+		}
+
+		// read one byte more than allowed to tell a file at the limit
+		// from a larger one
+		body, err := io.ReadAll(io.LimitReader(part, maxBytes+1))
+		part.Close()
+		if err != nil {
+			var maxBytesError *http.MaxBytesError
+			if errors.As(err, &maxBytesError) {
+				a.contentTooLargeResponse(w, r, maxBytes)
+				return nil, false
+			}
+			a.badRequestResponse(w, r, err)
+			return nil, false
+		}
+		if int64(len(body)) > maxBytes {
+			a.contentTooLargeResponse(w, r, maxBytes)
+			return nil, false
+		}
+
+		img, err := media.Decode(body, limits)
+		if err != nil {
+			switch {
+			case errors.Is(err, media.ErrUnsupportedType),
+				errors.Is(err, media.ErrInvalidImage),
+				errors.Is(err, media.ErrDimensions):
+				a.failedValidationResponse(w, r, map[string]string{"file": err.Error()})
+			default:
+				a.serverErrorResponse(w, r, err)
+			}
+			return nil, false
+		}
+		images = append(images, img)
+	}
+
+	if len(images) == 0 {
+		a.failedValidationResponse(w, r, map[string]string{"file": "must be provided"})
+		return nil, false
+	}
+
+	return images, true
+}
+
+// storeReviewMedia saves a photo and its thumbnail in the blob store and
+// returns the record to insert for them
+func (a *applicationDependencies) storeReviewMedia(ctx context.Context, review *data.Review, img *media.Image) (*data.ReviewMedia, error) {
+	thumbnail, err := img.Resize(a.config.media.thumbnailSize)
+	if err != nil {
+		return nil, err
+	}
+
+	key := media.RandomKey(fmt.Sprintf("reviews/%d", review.ID), img.Ext())
+	thumbnailKey := strings.TrimSuffix(key, img.Ext()) + "_thumb" + thumbnail.Ext()
+
+	err = a.blobStore.Put(ctx, key, bytes.NewReader(img.Data))
+	if err != nil {
+		return nil, err
+	}
+	err = a.blobStore.Put(ctx, thumbnailKey, bytes.NewReader(thumbnail.Data))
+	if err != nil {
+		a.deleteBlobs(key)
+		return nil, err
+	}
+
+	reviewMedia := &data.ReviewMedia{
+		ReviewID:     review.ID,
+		Key:          key,
+		ThumbnailKey: thumbnailKey,
+		ContentType:  img.ContentType,
+		Width:        img.Width,
+		Height:       img.Height,
+		Size:         int64(len(img.Data)),
+	}
+	return reviewMedia, nil
+}
+
+// deleteBlobs removes files from the blob store in the background, the
+// failures are only logged
+func (a *applicationDependencies) deleteBlobs(keys ...string) {
+	if len(keys) == 0 {
+		return
+	}
+
+	a.background(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		for _, key := range keys {
+			err := a.blobStore.Delete(ctx, key)
+			if err != nil && !errors.Is(err, media.ErrNotFound) {
+				a.logger.Error("deleting media", "key", key, "error", err.Error())
+			}
+		}
+	})
+}
+
+// serveMediaHandler sends back a stored photo. The keys are random and
+// never reused, so the files can be cached for good.
+func (a *applicationDependencies) serveMediaHandler(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, data.MediaURLPrefix)
+
+	file, err := a.blobStore.Get(r.Context(), key)
+	if err != nil {
+		switch {
+		case errors.Is(err, media.ErrNotFound), errors.Is(err, media.ErrInvalidKey):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	defer file.Close()
+
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if seeker, ok := file.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, "", time.Time{}, seeker)
+		return
+	}
+	io.Copy(w, file)
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The upper bounds of the histogram buckets
+var (
+	durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10} // seconds
+	sizeBuckets     = []float64{100, 1_000, 10_000, 100_000, 1_000_000}                  // bytes
+)
+
+// routeLabels identify the route a request was sent to. Requests that
+// did not match a route share the "unmatched" route.
+type routeLabels struct {
+	method string
+	route  string
+}
+
+// requestLabels add the status code class (2xx, 4xx...) to the route
+type requestLabels struct {
+	routeLabels
+	code string
+}
+
+// histogram counts observations in cumulative buckets, as Prometheus does
+type histogram struct {
+	buckets []float64
+	counts  []uint64 // observations per bucket, not cumulative
+	sum     float64
+	count   uint64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+	}
+}
+
+func (h *histogram) observe(value float64) {
+	for i, bound := range h.buckets {
+		if value <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += value
+	h.count++
+}
+
+// metrics holds the counters exposed at /debug/metrics
+type metrics struct {
+	mu            sync.Mutex
+	requests      map[requestLabels]uint64
+	durations     map[routeLabels]*histogram
+	responseSizes map[routeLabels]*histogram
+
+	inFlight    atomic.Int64
+	rateLimited atomic.Uint64 // requests rejected by the rate limiter
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		requests:      make(map[requestLabels]uint64),
+		durations:     make(map[routeLabels]*histogram),
+		responseSizes: make(map[routeLabels]*histogram),
+	}
+}
+
+// observeRequest records a finished request
+func (m *metrics) observeRequest(labels routeLabels, status int, size int, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[requestLabels{routeLabels: labels, code: fmt.Sprintf("%dxx", status/100)}]++
+
+	if m.durations[labels] == nil {
+		m.durations[labels] = newHistogram(durationBuckets)
+		m.responseSizes[labels] = newHistogram(sizeBuckets)
+	}
+	m.durations[labels].observe(duration.Seconds())
+	m.responseSizes[labels].observe(float64(size))
+}
+
+// write sends every metric in the Prometheus text exposition format
+func (m *metrics) write(w io.Writer, dbStats sql.DBStats) error {
+	buf := bufio.NewWriter(w)
+
+	m.mu.Lock()
+
+	writeHeader(buf, "productreview_http_requests_total", "counter", "Total HTTP requests by route and status code class.")
+	requestKeys := make([]requestLabels, 0, len(m.requests))
+	for key := range m.requests {
+		requestKeys = append(requestKeys, key)
+	}
+	sort.Slice(requestKeys, func(i, j int) bool {
+		if requestKeys[i].routeLabels != requestKeys[j].routeLabels {
+			return lessRouteLabels(requestKeys[i].routeLabels, requestKeys[j].routeLabels)
+		}
+		return requestKeys[i].code < requestKeys[j].code
+	})
+	for _, key := range requestKeys {
+		labels := formatLabels("method", key.method, "route", key.route, "code", key.code)
+		fmt.Fprintf(buf, "productreview_http_requests_total%s %d\n", labels, m.requests[key])
+	}
+
+	writeHistograms(buf, "productreview_http_request_duration_seconds", "HTTP request latency by route.", m.durations)
+	writeHistograms(buf, "productreview_http_response_size_bytes", "HTTP response body size by route.", m.responseSizes)
+
+	m.mu.Unlock()
+
+	writeHeader(buf, "productreview_http_requests_in_flight", "gauge", "HTTP requests currently being served.")
+	fmt.Fprintf(buf, "productreview_http_requests_in_flight %d\n", m.inFlight.Load())
+
+	writeHeader(buf, "productreview_rate_limit_rejections_total", "counter", "Requests rejected by the rate limiter.")
+	fmt.Fprintf(buf, "productreview_rate_limit_rejections_total %d\n", m.rateLimited.Load())
+
+	// database connection pool statistics from sql.DB.Stats()
+	dbMetrics := []struct {
+		name, kind, help string
+		value            float64
+	}{
+		{"productreview_db_max_open_connections", "gauge", "Maximum number of open connections to the database.", float64(dbStats.MaxOpenConnections)},
+		{"productreview_db_open_connections", "gauge", "Established connections, both in use and idle.", float64(dbStats.OpenConnections)},
+		{"productreview_db_in_use_connections", "gauge", "Connections currently in use.", float64(dbStats.InUse)},
+		{"productreview_db_idle_connections", "gauge", "Idle connections.", float64(dbStats.Idle)},
+		{"productreview_db_wait_count_total", "counter", "Total number of connections waited for.", float64(dbStats.WaitCount)},
+		{"productreview_db_wait_duration_seconds_total", "counter", "Total time blocked waiting for a new connection.", dbStats.WaitDuration.Seconds()},
+		{"productreview_db_max_idle_closed_total", "counter", "Connections closed due to the idle connection limit.", float64(dbStats.MaxIdleClosed)},
+		{"productreview_db_max_idle_time_closed_total", "counter", "Connections closed due to the idle time limit.", float64(dbStats.MaxIdleTimeClosed)},
+		{"productreview_db_max_lifetime_closed_total", "counter", "Connections closed due to the connection lifetime limit.", float64(dbStats.MaxLifetimeClosed)},
+	}
+	for _, metric := range dbMetrics {
+		writeHeader(buf, metric.name, metric.kind, metric.help)
+		fmt.Fprintf(buf, "%s %s\n", metric.name, formatFloat(metric.value))
+	}
+
+	return buf.Flush()
+}
+
+func writeHeader(w io.Writer, name string, kind string, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func writeHistograms(w io.Writer, name string, help string, histograms map[routeLabels]*histogram) {
+	writeHeader(w, name, "histogram", help)
+
+	keys := make([]routeLabels, 0, len(histograms))
+	for key := range histograms {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return lessRouteLabels(keys[i], keys[j]) })
+
+	for _, key := range keys {
+		h := histograms[key]
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += h.counts[i]
+			labels := formatLabels("method", key.method, "route", key.route, "le", formatFloat(bound))
+			fmt.Fprintf(w, "%s_bucket%s %d\n", name, labels, cumulative)
+		}
+		labels := formatLabels("method", key.method, "route", key.route, "le", "+Inf")
+		fmt.Fprintf(w, "%s_bucket%s %d\n", name, labels, h.count)
+
+		labels = formatLabels("method", key.method, "route", key.route)
+		fmt.Fprintf(w, "%s_sum%s %s\n", name, labels, formatFloat(h.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", name, labels, h.count)
+	}
+}
+
+func lessRouteLabels(a routeLabels, b routeLabels) bool {
+	if a.route != b.route {
+		return a.route < b.route
+	}
+	return a.method < b.method
+}
+
+// formatLabels turns name/value pairs into a Prometheus label set
+func formatLabels(pairs ...string) string {
+	escaper := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+	labels := make([]string, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		labels = append(labels, fmt.Sprintf(`%s="%s"`, pairs[i], escaper.Replace(pairs[i+1])))
+	}
+	return "{" + strings.Join(labels, ",") + "}"
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// metricsHandler exposes the metrics in the Prometheus text format
+func (a *applicationDependencies) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	err := a.metrics.write(w, a.db.Stats())
+	if err != nil {
+		a.logError(r, err)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsWrite(t *testing.T) {
+	m := newMetrics()
+	route := routeLabels{method: "GET", route: "/v1/products/:prod_id"}
+	m.observeRequest(route, 200, 50, 3*time.Millisecond)
+	m.observeRequest(route, 200, 5_000, 200*time.Millisecond)
+	m.observeRequest(route, 404, 80, 20*time.Second) // past the last bucket
+	m.rateLimited.Add(2)
+
+	var out strings.Builder
+	err := m.write(&out, sql.DBStats{MaxOpenConnections: 25})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	labels := `method="GET",route="/v1/products/:prod_id"`
+	for _, line := range []string{
+		`productreview_http_requests_total{` + labels + `,code="2xx"} 2`,
+		`productreview_http_requests_total{` + labels + `,code="4xx"} 1`,
+		// the buckets are cumulative
+		`productreview_http_request_duration_seconds_bucket{` + labels + `,le="0.005"} 1`,
+		`productreview_http_request_duration_seconds_bucket{` + labels + `,le="0.25"} 2`,
+		`productreview_http_request_duration_seconds_bucket{` + labels + `,le="10"} 2`,
+		`productreview_http_request_duration_seconds_bucket{` + labels + `,le="+Inf"} 3`,
+		`productreview_http_request_duration_seconds_count{` + labels + `} 3`,
+		`productreview_http_response_size_bytes_bucket{` + labels + `,le="100"} 2`,
+		`productreview_http_response_size_bytes_sum{` + labels + `} 5130`,
+		`productreview_rate_limit_rejections_total 2`,
+		`productreview_db_max_open_connections 25`,
+		`# TYPE productreview_http_request_duration_seconds histogram`,
+	} {
+		if !strings.Contains(out.String(), line+"\n") {
+			t.Errorf("missing line %s", line)
+		}
+	}
+}
+
+func TestFormatLabels(t *testing.T) {
+	got := formatLabels("route", `/a"b\c`+"\n", "code", "2xx")
+	want := `{route="/a\"b\\c\n",code="2xx"}`
+	if got != want {
+		t.Errorf("formatLabels = %s, want %s", got, want)
+	}
+}
@@ -1,13 +1,16 @@
 package main
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
 	"fmt"
-	"net"
+	"math"
 	"net/http"
-	"sync"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
-
-	"golang.org/x/time/rate"
 )
 
 func (a *applicationDependencies) recoverPanic(next http.Handler) http.Handler {
@@ -25,64 +28,253 @@ func (a *applicationDependencies) recoverPanic(next http.Handler) http.Handler {
 	})
 }
 
-func (a *applicationDependencies) rateLimit(next http.Handler) http.Handler {
+// requireAdmin only lets through requests carrying the -admin-token as
+// a Bearer token. Every request is refused while no token is configured.
+func (a *applicationDependencies) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Authorization")
 
-	// Define a rate limiter struct
-	type client struct {
-		limiter  *rate.Limiter
-		lastSeen time.Time // remove map entries that are stale
-	}
+		scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") || a.config.adminToken == "" {
+			a.invalidAuthenticationTokenResponse(w, r)
+			return
+		}
 
-	var mu sync.Mutex                      // use to synchronize the map
-	var clients = make(map[string]*client) // the actual map
-	// A goroutine to remove stale entries from the map
-	go func() {
-		for {
-			time.Sleep(time.Minute)
-			mu.Lock() // begin cleanup
-			// delete any entry not seen in three minutes
-			for ip, client := range clients {
-				if time.Since(client.lastSeen) > 3*time.Minute {
-					delete(clients, ip)
-				}
-			}
-			mu.Unlock() // finish clean up
+		// compare in constant time so the token cannot be guessed from
+		// the response times
+		if subtle.ConstantTimeCompare([]byte(strings.TrimSpace(token)), []byte(a.config.adminToken)) != 1 {
+			a.invalidAuthenticationTokenResponse(w, r)
+			return
 		}
-	}()
 
+		next(w, r)
+	}
+}
+
+// rateLimitPolicy is the number of requests a client can make, as a
+// sustained rate plus an initial burst
+type rateLimitPolicy struct {
+	name  string // keeps the buckets of different policies apart
+	rps   float64
+	burst int
+}
+
+// rateLimit applies the global limit to every request
+func (a *applicationDependencies) rateLimit(next http.Handler) http.Handler {
+	policy := rateLimitPolicy{name: "global", rps: a.config.limiter.rps, burst: a.config.limiter.burst}
+	return a.rateLimitWith(policy, next)
+}
+
+// rateLimitWith limits every client to the rate of the policy. It can
+// also wrap single routes with a stricter limit than the global one.
+func (a *applicationDependencies) rateLimitWith(policy rateLimitPolicy, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// get the IP address
 
-		if a.config.limiter.enabled {
-			ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		// OPTIONS requests, CORS preflights among them, are answered by
+		// preflightHandler without any work, and a browser sends one
+		// before many requests: they would halve the rate of its client
+		if a.config.limiter.enabled && r.Method != http.MethodOptions {
+			// get the IP address, looking past our own proxies
+			ip := a.clientIP(r)
+
+			result, err := a.limiter.allow(r.Context(), policy.name+":"+ip, policy)
 			if err != nil {
-				a.serverErrorResponse(w, r, err)
+				// a broken limiter backend should not take the API down
+				a.logError(r, err)
+				next.ServeHTTP(w, r)
 				return
 			}
 
-			mu.Lock() // exclusive access to the map
-			// check if ip address already in map, if not add it
-			_, found := clients[ip]
-			if !found {
-				clients[ip] = &client{limiter: rate.NewLimiter(
-					rate.Limit(a.config.limiter.rps),
-					a.config.limiter.burst),
-				}
-			}
-
-			// Update the last seem for the client
-			clients[ip].lastSeen = time.Now()
-
-			// Check the rate limit status
-			if !clients[ip].limiter.Allow() {
-				mu.Unlock() // no longer need exclusive access to the map
+			setRateLimitHeaders(w, policy, result.tokens, result.allowed)
+			if !result.allowed {
+				a.metrics.rateLimited.Add(1)
 				a.rateLimitExceededResponse(w, r)
 				return
 			}
+		}
+		next.ServeHTTP(w, r)
+	})
+
+}
+
+// setRateLimitHeaders tells the client how much of its limit is left
+// (RateLimit-* headers) and, once limited, when to try again
+func setRateLimitHeaders(w http.ResponseWriter, policy rateLimitPolicy, tokens float64, allowed bool) {
+	// seconds until the bucket holds the given number of tokens
+	secondsUntil := func(target float64) int {
+		if tokens >= target || policy.rps <= 0 {
+			return 0
+		}
+		return int(math.Ceil((target - tokens) / policy.rps))
+	}
+
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(policy.burst))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(max(0, int(math.Floor(tokens)))))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(secondsUntil(float64(policy.burst))))
+	if !allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(max(1, secondsUntil(1))))
+	}
+}
+
+// The request headers a trusted origin may send, and the response
+// headers its scripts may read
+const (
+	corsAllowedHeaders = "Authorization, Content-Type, X-Request-ID"
+	corsExposedHeaders = "Link, Location, X-Total-Count, X-Request-ID, RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, Retry-After"
+)
+
+func (a *applicationDependencies) enableCORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The response depends on these request headers, so caches
+		// must not hand a response for one origin to another origin
+		w.Header().Add("Vary", "Origin")
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+
+		// untrusted origins get no CORS headers at all
+		origin := r.Header.Get("Origin")
+		if a.isTrustedOrigin(origin) {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Expose-Headers", corsExposedHeaders)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isTrustedOrigin checks the origin against the -cors-trusted-origins list
+func (a *applicationDependencies) isTrustedOrigin(origin string) bool {
+	return origin != "" && slices.Contains(a.config.cors.trustedOrigins, origin)
+}
 
-			mu.Unlock() // others are free to get exclusive access to the map
+// preflightHandler answers OPTIONS requests for every route. The router
+// has already set the Allow header to the methods the path supports.
+func (a *applicationDependencies) preflightHandler(w http.ResponseWriter, r *http.Request) {
+	isPreflight := r.Header.Get("Access-Control-Request-Method") != ""
+	if isPreflight && a.isTrustedOrigin(r.Header.Get("Origin")) {
+		w.Header().Set("Access-Control-Allow-Methods", w.Header().Get("Allow"))
+		w.Header().Set("Access-Control-Allow-Headers", corsAllowedHeaders)
+		w.Header().Set("Access-Control-Max-Age", "600")
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// responseRecorder wraps a http.ResponseWriter to remember the status
+// code and the number of bytes written
+type responseRecorder struct {
+	wrapped       http.ResponseWriter
+	statusCode    int
+	headerWritten bool
+	bytesWritten  int
+}
+
+func newResponseRecorder(w http.ResponseWriter) *responseRecorder {
+	return &responseRecorder{
+		wrapped:    w,
+		statusCode: http.StatusOK,
+	}
+}
+
+func (rr *responseRecorder) Header() http.Header {
+	return rr.wrapped.Header()
+}
+
+func (rr *responseRecorder) WriteHeader(statusCode int) {
+	rr.wrapped.WriteHeader(statusCode)
+	if !rr.headerWritten {
+		rr.statusCode = statusCode
+		rr.headerWritten = true
+	}
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	rr.headerWritten = true
+	n, err := rr.wrapped.Write(b)
+	rr.bytesWritten += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the original writer
+func (rr *responseRecorder) Unwrap() http.ResponseWriter {
+	return rr.wrapped
+}
+
+func (a *applicationDependencies) recordMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		a.metrics.inFlight.Add(1)
+		defer a.metrics.inFlight.Add(-1)
+
+		// the route handler fills in the pattern it was registered with
+		r, route := a.contextWithRouteHolder(r)
+		rr := newResponseRecorder(w)
+
+		next.ServeHTTP(rr, r)
+
+		labels := routeLabels{method: r.Method, route: route.pattern}
+		if labels.route == "" {
+			labels.route = "unmatched"
+		}
+		a.metrics.observeRequest(labels, rr.statusCode, rr.bytesWritten, time.Since(start))
+	})
+}
+
+// requestID accepts the X-Request-ID sent by the client, or generates
+// one, so that a request can be matched to its log lines
+func (a *applicationDependencies) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !isValidRequestID(id) {
+			id = newRequestID()
 		}
+
+		r = a.contextSetRequestID(r, id)
+		w.Header().Set("X-Request-ID", id)
+
 		next.ServeHTTP(w, r)
 	})
+}
+
+// isValidRequestID only accepts short ids made of characters that are
+// safe to write to the logs and echo back in a header
+func isValidRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns 16 random bytes as a hex string
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// logRequest writes one access log line per request
+func (a *applicationDependencies) logRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rr := newResponseRecorder(w)
 
+		next.ServeHTTP(rr, r)
+
+		a.logger.Info("request",
+			"request_id", a.contextGetRequestID(r),
+			"method", r.Method,
+			"uri", r.URL.RequestURI(),
+			"route", a.contextGetRoute(r),
+			"status", rr.statusCode,
+			"duration", time.Since(start),
+			"bytes", rr.bytesWritten,
+			"client_ip", a.clientIP(r),
+		)
+	})
 }
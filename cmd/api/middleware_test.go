@@ -0,0 +1,215 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestEnableCORS(t *testing.T) {
+	a := &applicationDependencies{}
+	a.config.cors.trustedOrigins = []string{"https://shop.example.com", "http://localhost:3000"}
+
+	tests := []struct {
+		origin string
+		want   string // the Access-Control-Allow-Origin header
+	}{
+		{"https://shop.example.com", "https://shop.example.com"},
+		{"http://localhost:3000", "http://localhost:3000"},
+		{"", ""},
+		{"https://evil.example.com", ""},
+		{"https://shop.example.com.evil.com", ""},
+		{"http://shop.example.com", ""}, // the scheme is part of the origin
+		{"null", ""},
+	}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/v1/products", nil)
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+		w := httptest.NewRecorder()
+		a.enableCORS(next).ServeHTTP(w, r)
+
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.want {
+			t.Errorf("origin %q: Access-Control-Allow-Origin = %q, want %q", tt.origin, got, tt.want)
+		}
+		if exposed := w.Header().Get("Access-Control-Expose-Headers"); (exposed != "") != (tt.want != "") {
+			t.Errorf("origin %q: Access-Control-Expose-Headers = %q", tt.origin, exposed)
+		}
+		// the response varies on the origin whether it is trusted or not
+		if vary := w.Header().Values("Vary"); len(vary) != 2 || vary[0] != "Origin" {
+			t.Errorf("origin %q: Vary = %q, want Origin and Access-Control-Request-Method", tt.origin, vary)
+		}
+	}
+}
+
+func TestPreflightHandler(t *testing.T) {
+	a := &applicationDependencies{}
+	a.config.cors.trustedOrigins = []string{"https://shop.example.com"}
+
+	tests := []struct {
+		name    string
+		origin  string
+		method  string // Access-Control-Request-Method
+		allowed bool
+	}{
+		{"trusted preflight", "https://shop.example.com", "PATCH", true},
+		{"untrusted origin", "https://evil.example.com", "PATCH", false},
+		{"plain OPTIONS request", "https://shop.example.com", "", false},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodOptions, "/v1/products/1", nil)
+		r.Header.Set("Origin", tt.origin)
+		if tt.method != "" {
+			r.Header.Set("Access-Control-Request-Method", tt.method)
+		}
+		w := httptest.NewRecorder()
+		w.Header().Set("Allow", "GET, OPTIONS, PATCH, PUT, DELETE")
+		a.preflightHandler(w, r)
+
+		if w.Code != http.StatusNoContent {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, http.StatusNoContent)
+		}
+		methods := w.Header().Get("Access-Control-Allow-Methods")
+		if tt.allowed && methods != "GET, OPTIONS, PATCH, PUT, DELETE" {
+			t.Errorf("%s: Access-Control-Allow-Methods = %q, want the Allow header", tt.name, methods)
+		}
+		if !tt.allowed && methods != "" {
+			t.Errorf("%s: Access-Control-Allow-Methods = %q, want none", tt.name, methods)
+		}
+	}
+}
+
+func TestIsValidRequestID(t *testing.T) {
+	tests := []struct {
+		id    string
+		valid bool
+	}{
+		{"3f9a0c1e2b7d4a56", true},
+		{"req-2024_05.01", true},
+		{strings.Repeat("a", 128), true},
+		{"", false},
+		{strings.Repeat("a", 129), false},
+		{"has space", false},
+		{"line\nbreak", false},
+		{`quote"d`, false},
+		{"ünïcode", false},
+	}
+
+	for _, tt := range tests {
+		if got := isValidRequestID(tt.id); got != tt.valid {
+			t.Errorf("isValidRequestID(%q) = %t, want %t", tt.id, got, tt.valid)
+		}
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	a := &applicationDependencies{}
+
+	tests := []struct {
+		name string
+		sent string
+		keep bool
+	}{
+		{"valid id", "abc-123", true},
+		{"no id", "", false},
+		{"invalid id", "abc 123\r\nX-Injected: 1", false},
+	}
+
+	for _, tt := range tests {
+		var seen string
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			seen = a.contextGetRequestID(r)
+		})
+
+		r := httptest.NewRequest(http.MethodGet, "/v1/healthcheck", nil)
+		if tt.sent != "" {
+			r.Header.Set("X-Request-ID", tt.sent)
+		}
+		w := httptest.NewRecorder()
+		a.requestID(next).ServeHTTP(w, r)
+
+		got := w.Header().Get("X-Request-ID")
+		if got != seen {
+			t.Errorf("%s: header %q and context %q differ", tt.name, got, seen)
+		}
+		if tt.keep && got != tt.sent {
+			t.Errorf("%s: X-Request-ID = %q, want %q", tt.name, got, tt.sent)
+		}
+		if !tt.keep && (got == tt.sent || len(got) != 32 || !isValidRequestID(got)) {
+			t.Errorf("%s: X-Request-ID = %q, want a new 32 character id", tt.name, got)
+		}
+	}
+}
+
+func TestSetRateLimitHeaders(t *testing.T) {
+	policy := rateLimitPolicy{name: "global", rps: 2, burst: 5}
+
+	tests := []struct {
+		name       string
+		tokens     float64
+		allowed    bool
+		remaining  string
+		reset      string
+		retryAfter string
+	}{
+		{"full bucket", 5, true, "5", "0", ""},
+		{"partly used", 3.4, true, "3", "1", ""},
+		{"last token", 0.2, true, "0", "3", ""},
+		{"rejected", -0.5, false, "0", "3", "1"},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		setRateLimitHeaders(w, policy, tt.tokens, tt.allowed)
+
+		for header, want := range map[string]string{
+			"RateLimit-Limit":     "5",
+			"RateLimit-Remaining": tt.remaining,
+			"RateLimit-Reset":     tt.reset,
+			"Retry-After":         tt.retryAfter,
+		} {
+			if got := w.Header().Get(header); got != want {
+				t.Errorf("%s: %s = %q, want %q", tt.name, header, got, want)
+			}
+		}
+	}
+}
+
+func TestRateLimitSkipsOptions(t *testing.T) {
+	a := &applicationDependencies{limiter: newMemoryRateLimiter(), metrics: newMetrics()}
+	a.config.limiter.enabled = true
+	a.config.cors.trustedOrigins = []string{"https://shop.example.com"}
+
+	policy := rateLimitPolicy{name: "global", rps: 0.001, burst: 1}
+	handler := a.enableCORS(a.rateLimitWith(policy, http.HandlerFunc(a.preflightHandler)))
+
+	send := func(method string) int {
+		r := httptest.NewRequest(method, "/v1/products", nil)
+		r.RemoteAddr = "203.0.113.7:5000"
+		r.Header.Set("Origin", "https://shop.example.com")
+		if method == http.MethodOptions {
+			r.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	for i := 0; i < 3; i++ {
+		if code := send(http.MethodOptions); code != http.StatusNoContent {
+			t.Fatalf("preflight %d: status %d, want %d", i+1, code, http.StatusNoContent)
+		}
+	}
+	// the preflights left the only token of the bucket
+	if code := send(http.MethodPost); code != http.StatusNoContent {
+		t.Fatalf("request after the preflights: status %d, want %d", code, http.StatusNoContent)
+	}
+	if code := send(http.MethodPost); code != http.StatusTooManyRequests {
+		t.Fatalf("second request: status %d, want %d", code, http.StatusTooManyRequests)
+	}
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/georgie5/productReview/internal/data"
+	"github.com/georgie5/productReview/internal/screening"
+	"github.com/georgie5/productReview/internal/validator"
+)
+
+// moderationRequired tells whether the reviews of a product wait for a
+// moderator before they are published
+func (a *applicationDependencies) moderationRequired(product *data.Product) bool {
+	if a.config.moderation.required {
+		return true
+	}
+	for _, category := range a.config.moderation.categories {
+		if strings.EqualFold(category, product.Category) {
+			return true
+		}
+	}
+	return false
+}
+
+// requeueEditedReview sends a review whose rating or content changed back
+// to the moderation queue, when its product needs moderation or when a
+// moderator had rejected it
+func (a *applicationDependencies) requeueEditedReview(original data.Review, review *data.Review, product *data.Product) {
+	if review.Rating == original.Rating && review.Content == original.Content {
+		return
+	}
+	a.requeueReview(review, product)
+}
+
+// requeueReview sends a changed review back to the moderation queue, when
+// its product needs moderation or when a moderator had rejected it
+func (a *applicationDependencies) requeueReview(review *data.Review, product *data.Product) {
+	if a.moderationRequired(product) || review.Status == data.ReviewStatusRejected {
+		review.Status = data.ReviewStatusPending
+		review.RejectionReason = ""
+	}
+}
+
+// screenContent runs the automatic screening on the content of a review
+// or comment. It returns false, after sending a 422, when the content is
+// rejected.
+func (a *applicationDependencies) screenContent(w http.ResponseWriter, r *http.Request, content string) (screening.Result, bool) {
+	result := a.screener.Screen(content)
+	if result.Verdict == screening.Reject {
+		a.failedValidationResponse(w, r, map[string]string{"content": "was rejected: " + result.Summary()})
+		return result, false
+	}
+	return result, true
+}
+
+// screenedReview is a review as moderators see it, with what the
+// automatic screening decided about it
+type screenedReview struct {
+	*data.Review
+	ScreeningVerdict string   `json:"screening_verdict"`
+	ScreeningReasons []string `json:"screening_reasons,omitempty"`
+}
+
+func screenedReviews(reviews []*data.Review) []screenedReview {
+	screened := make([]screenedReview, len(reviews))
+	for i, review := range reviews {
+		screened[i] = screenedReview{review, review.ScreeningVerdict, review.ScreeningReasons}
+	}
+	return screened
+}
+
+// screenedComment is screenedReview for comments
+type screenedComment struct {
+	*data.Comment
+	ScreeningVerdict string   `json:"screening_verdict"`
+	ScreeningReasons []string `json:"screening_reasons,omitempty"`
+}
+
+func screenedComments(comments []*data.Comment) []screenedComment {
+	screened := make([]screenedComment, len(comments))
+	for i, comment := range comments {
+		screened[i] = screenedComment{comment, comment.ScreeningVerdict, comment.ScreeningReasons}
+	}
+	return screened
+}
+
+// screenReview screens the content of a review and stores the result on
+// it. A flagged review waits for a moderator.
+func (a *applicationDependencies) screenReview(w http.ResponseWriter, r *http.Request, review *data.Review) bool {
+	result, ok := a.screenContent(w, r, review.Content)
+	if !ok {
+		return false
+	}
+
+	review.ScreeningVerdict = string(result.Verdict)
+	review.ScreeningReasons = result.Reasons
+	if result.Verdict == screening.Flag {
+		review.Status = data.ReviewStatusPending
+		review.RejectionReason = ""
+	}
+	return true
+}
+
+// screenComment is screenReview for comments
+func (a *applicationDependencies) screenComment(w http.ResponseWriter, r *http.Request, comment *data.Comment) bool {
+	result, ok := a.screenContent(w, r, comment.Content)
+	if !ok {
+		return false
+	}
+
+	comment.ScreeningVerdict = string(result.Verdict)
+	comment.ScreeningReasons = result.Reasons
+	if result.Verdict == screening.Flag {
+		comment.Status = data.ReviewStatusPending
+		comment.RejectionReason = ""
+	}
+	return true
+}
+
+// listModerationQueueHandler lists the reviews waiting for a moderator,
+// oldest first, or the reviews with another ?status= (hidden for the
+// reviews hidden by reports)
+func (a *applicationDependencies) listModerationQueueHandler(w http.ResponseWriter, r *http.Request) {
+
+	var queryParametersData struct {
+		Status string
+		data.Filters
+	}
+
+	v := validator.New()
+	query := r.URL.Query()
+	queryParametersData.Status = a.getSingleQueryParameter(query, "status", data.ReviewStatusPending)
+
+	queryParametersData.Filters.Page = a.getSingleIntegerParameter(query, "page", 1, v)
+	queryParametersData.Filters.PageSize = a.getSingleIntegerParameter(query, "page_size", 20, v)
+	queryParametersData.Filters.Sort = a.getSingleQueryParameter(query, "sort", "id")
+	queryParametersData.Filters.SortSafeList = []string{"id", "product_id", "rating", "-id", "-product_id", "-rating"}
+
+	v.Check(validator.PermittedValue(queryParametersData.Status,
+		data.ReviewStatusPending, data.ReviewStatusApproved, data.ReviewStatusRejected, data.ReviewStatusHidden),
+		"status", "must be pending, approved, rejected or hidden")
+	data.ValidateFilters(v, queryParametersData.Filters)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	reviews, metadata, err := a.reviewModel.GetAllByStatus(queryParametersData.Status, queryParametersData.Filters)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	links, headers := a.paginate(r, metadata)
+	responseData := envelope{
+		"reviews":   screenedReviews(reviews),
+		"@metadata": metadata,
+		"links":     links,
+	}
+	err = a.writeJSON(w, r, http.StatusOK, responseData, headers)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// approveReviewHandler publishes a review
+func (a *applicationDependencies) approveReviewHandler(w http.ResponseWriter, r *http.Request) {
+	a.moderateReview(w, r, data.ReviewStatusApproved, "")
+}
+
+// rejectReviewHandler hides a review, with a reason for its author
+func (a *applicationDependencies) rejectReviewHandler(w http.ResponseWriter, r *http.Request) {
+	reason, ok := a.readRejection(w, r)
+	if !ok {
+		return
+	}
+	a.moderateReview(w, r, data.ReviewStatusRejected, reason)
+}
+
+// readRejection reads the reason of a rejection from the request body
+func (a *applicationDependencies) readRejection(w http.ResponseWriter, r *http.Request) (string, bool) {
+
+	var input struct {
+		Reason string `json:"reason"`
+	}
+
+	err := a.readJSON(w, r, &input)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return "", false
+	}
+
+	input.Reason = strings.TrimSpace(input.Reason)
+
+	v := validator.New()
+	data.ValidateRejection(v, input.Reason)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return "", false
+	}
+
+	return input.Reason, true
+}
+
+// moderateReview records a moderator decision, which settles the reports
+// of the review, and updates the average rating of the product, which
+// only counts approved reviews
+func (a *applicationDependencies) moderateReview(w http.ResponseWriter, r *http.Request, status string, reason string) {
+
+	reviewID, err := a.readIDParam(r, "review_id")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	review, err := a.reviewModel.GetByID(reviewID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	review.Status = status
+	review.RejectionReason = reason
+
+	err = a.reviewModel.Moderate(review)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// the reports no longer count toward hiding the review again
+	err = a.reportModel.ResolveForReview(review.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = a.productModel.UpdateAverageRating(review.ProductID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{"review": screenedReview{review, review.ScreeningVerdict, review.ScreeningReasons}}
+	err = a.writeJSON(w, r, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// listCommentQueueHandler lists the comments waiting for a moderator,
+// oldest first, or the comments with another ?status=
+func (a *applicationDependencies) listCommentQueueHandler(w http.ResponseWriter, r *http.Request) {
+
+	var queryParametersData struct {
+		Status string
+		data.Filters
+	}
+
+	v := validator.New()
+	query := r.URL.Query()
+	queryParametersData.Status = a.getSingleQueryParameter(query, "status", data.ReviewStatusPending)
+
+	queryParametersData.Filters.Page = a.getSingleIntegerParameter(query, "page", 1, v)
+	queryParametersData.Filters.PageSize = a.getSingleIntegerParameter(query, "page_size", 20, v)
+	queryParametersData.Filters.Sort = a.getSingleQueryParameter(query, "sort", "id")
+	queryParametersData.Filters.SortSafeList = []string{"id", "review_id", "-id", "-review_id"}
+
+	v.Check(validator.PermittedValue(queryParametersData.Status,
+		data.ReviewStatusPending, data.ReviewStatusApproved, data.ReviewStatusRejected),
+		"status", "must be pending, approved or rejected")
+	data.ValidateFilters(v, queryParametersData.Filters)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	comments, metadata, err := a.commentModel.GetAllByStatus(queryParametersData.Status, queryParametersData.Filters)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	links, headers := a.paginate(r, metadata)
+	responseData := envelope{
+		"comments":  screenedComments(comments),
+		"@metadata": metadata,
+		"links":     links,
+	}
+	err = a.writeJSON(w, r, http.StatusOK, responseData, headers)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// approveCommentHandler publishes a comment
+func (a *applicationDependencies) approveCommentHandler(w http.ResponseWriter, r *http.Request) {
+	a.moderateComment(w, r, data.ReviewStatusApproved, "")
+}
+
+// rejectCommentHandler hides a comment, with a reason for its author
+func (a *applicationDependencies) rejectCommentHandler(w http.ResponseWriter, r *http.Request) {
+	reason, ok := a.readRejection(w, r)
+	if !ok {
+		return
+	}
+	a.moderateComment(w, r, data.ReviewStatusRejected, reason)
+}
+
+// moderateComment records a moderator decision about a comment
+func (a *applicationDependencies) moderateComment(w http.ResponseWriter, r *http.Request, status string, reason string) {
+
+	commentID, err := a.readIDParam(r, "comment_id")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	comment, err := a.commentModel.GetByID(commentID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	comment.Status = status
+	comment.RejectionReason = reason
+
+	err = a.commentModel.Moderate(comment)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{"comment": screenedComment{comment, comment.ScreeningVerdict, comment.ScreeningReasons}}
+	err = a.writeJSON(w, r, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
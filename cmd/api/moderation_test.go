@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/georgie5/productReview/internal/data"
+)
+
+func TestModerationRequired(t *testing.T) {
+	tests := []struct {
+		name       string
+		required   bool
+		categories []string
+		category   string
+		want       bool
+	}{
+		{name: "no moderation", category: "Kitchen", want: false},
+		{name: "all reviews", required: true, category: "Kitchen", want: true},
+		{name: "listed category", categories: []string{"Toys", "Kitchen"}, category: "Kitchen", want: true},
+		{name: "category in another case", categories: []string{"kitchen"}, category: "KITCHEN", want: true},
+		{name: "other category", categories: []string{"Toys"}, category: "Kitchen", want: false},
+	}
+
+	for _, tt := range tests {
+		app := &applicationDependencies{}
+		app.config.moderation.required = tt.required
+		app.config.moderation.categories = tt.categories
+
+		got := app.moderationRequired(&data.Product{Category: tt.category})
+		if got != tt.want {
+			t.Errorf("%s: moderationRequired = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRequeueEditedReview(t *testing.T) {
+	original := data.Review{Rating: 4, Content: "Works well", Status: data.ReviewStatusApproved}
+
+	tests := []struct {
+		name       string
+		required   bool
+		status     string
+		rating     int
+		content    string
+		wantStatus string
+	}{
+		{name: "unchanged", required: true, status: data.ReviewStatusApproved, rating: 4, content: "Works well", wantStatus: data.ReviewStatusApproved},
+		{name: "edited without moderation", status: data.ReviewStatusApproved, rating: 2, content: "Works well", wantStatus: data.ReviewStatusApproved},
+		{name: "edited with moderation", required: true, status: data.ReviewStatusApproved, rating: 4, content: "Stopped working", wantStatus: data.ReviewStatusPending},
+		{name: "rejected and edited", status: data.ReviewStatusRejected, rating: 4, content: "Stopped working", wantStatus: data.ReviewStatusPending},
+		{name: "rejected and unchanged", status: data.ReviewStatusRejected, rating: 4, content: "Works well", wantStatus: data.ReviewStatusRejected},
+	}
+
+	for _, tt := range tests {
+		app := &applicationDependencies{}
+		app.config.moderation.required = tt.required
+
+		original := original
+		original.Status = tt.status
+		review := original
+		review.Rating, review.Content = tt.rating, tt.content
+		review.RejectionReason = "spam"
+
+		app.requeueEditedReview(original, &review, &data.Product{Category: "Kitchen"})
+		if review.Status != tt.wantStatus {
+			t.Errorf("%s: status = %q, want %q", tt.name, review.Status, tt.wantStatus)
+		}
+		if review.Status == data.ReviewStatusPending && review.RejectionReason != "" {
+			t.Errorf("%s: rejection reason %q was kept", tt.name, review.RejectionReason)
+		}
+	}
+}
+
+func TestRequeueReview(t *testing.T) {
+	tests := []struct {
+		required   bool
+		status     string
+		wantStatus string
+	}{
+		{false, data.ReviewStatusApproved, data.ReviewStatusApproved},
+		{true, data.ReviewStatusApproved, data.ReviewStatusPending},
+		{false, data.ReviewStatusPending, data.ReviewStatusPending},
+		{false, data.ReviewStatusRejected, data.ReviewStatusPending},
+		{false, data.ReviewStatusHidden, data.ReviewStatusHidden},
+		{true, data.ReviewStatusHidden, data.ReviewStatusPending},
+	}
+
+	for _, tt := range tests {
+		app := &applicationDependencies{}
+		app.config.moderation.required = tt.required
+
+		review := &data.Review{Status: tt.status}
+		app.requeueReview(review, &data.Product{Category: "Kitchen"})
+		if review.Status != tt.wantStatus {
+			t.Errorf("requeueReview of a %s review with moderation %t: status = %q, want %q", tt.status, tt.required, review.Status, tt.wantStatus)
+		}
+	}
+}
+
+func TestScreenedReviews(t *testing.T) {
+	review := &data.Review{ID: 1, Rating: 5, Content: "Great", ScreeningVerdict: "flag", ScreeningReasons: []string{"contains a link"}}
+
+	// readers never see what the screening decided
+	public, err := json.Marshal(review)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(public), "screening") {
+		t.Errorf("review JSON %s contains the screening verdict", public)
+	}
+
+	// moderators do
+	screened, err := json.Marshal(screenedReviews([]*data.Review{review}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"screening_verdict":"flag"`, `"screening_reasons":["contains a link"]`, `"content":"Great"`} {
+		if !strings.Contains(string(screened), want) {
+			t.Errorf("screened JSON %s does not contain %s", screened, want)
+		}
+	}
+}
+
+func TestScreenedComments(t *testing.T) {
+	comment := &data.Comment{ID: 1, ReviewID: 2, Content: "Does it fit?", ScreeningVerdict: "allow"}
+
+	public, err := json.Marshal(comment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(public), "screening") {
+		t.Errorf("comment JSON %s contains the screening verdict", public)
+	}
+
+	screened, err := json.Marshal(screenedComments([]*data.Comment{comment}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(screened), `"screening_verdict":"allow"`) || strings.Contains(string(screened), "screening_reasons") {
+		t.Errorf("screened JSON %s, want the verdict without reasons", screened)
+	}
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// The media types accepted for PATCH request bodies on top of plain JSON
+const (
+	mergePatchMediaType = "application/merge-patch+json" // RFC 7386
+	jsonPatchMediaType  = "application/json-patch+json"  // RFC 6902
+)
+
+// errPatchTestFailed is returned when a JSON Patch "test" operation
+// does not match the current state of the resource
+var errPatchTestFailed = errors.New("the patch was not applied because a test operation failed")
+
+// patchOperation is a single operation of a JSON Patch document
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// requestMediaType returns the media type of the request body without
+// any parameters. A request without a Content-Type is treated as JSON.
+func (a *applicationDependencies) requestMediaType(r *http.Request) string {
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		return "application/json"
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return mediaType
+}
+
+// readPatch reads a merge patch or JSON patch from the request body and
+// applies it to destination, which holds the current editable fields of
+// the resource. The patch is applied to a copy, so destination is only
+// changed when every operation succeeds.
+func (a *applicationDependencies) readPatch(w http.ResponseWriter, r *http.Request, destination any) error {
+
+	// readJSON keeps the size limit and the single value check
+	var patch json.RawMessage
+	err := a.readJSON(w, r, &patch)
+	if err != nil {
+		return err
+	}
+
+	// turn the current state into a generic JSON document
+	current, err := json.Marshal(destination)
+	if err != nil {
+		return err
+	}
+	var document any
+	err = json.Unmarshal(current, &document)
+	if err != nil {
+		return err
+	}
+
+	switch a.requestMediaType(r) {
+	case mergePatchMediaType:
+		var mergePatch any
+		err = json.Unmarshal(patch, &mergePatch)
+		if err != nil {
+			return a.decodeJSONError(err)
+		}
+		document = applyMergePatch(document, mergePatch)
+	case jsonPatchMediaType:
+		var operations []patchOperation
+		dec := json.NewDecoder(bytes.NewReader(patch))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&operations)
+		if err != nil {
+			return a.decodeJSONError(err)
+		}
+		document, err = applyJSONPatch(document, operations)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported patch media type %q", a.requestMediaType(r))
+	}
+
+	patched, err := json.Marshal(document)
+	if err != nil {
+		return err
+	}
+
+	// decode into a zeroed value so that removed fields are cleared, and
+	// check for unknown fields just like readJSON does
+	value := reflect.New(reflect.TypeOf(destination).Elem())
+	dec := json.NewDecoder(bytes.NewReader(patched))
+	dec.DisallowUnknownFields()
+	err = dec.Decode(value.Interface())
+	if err != nil {
+		return a.decodeJSONError(err)
+	}
+	reflect.ValueOf(destination).Elem().Set(value.Elem())
+
+	return nil
+}
+
+// applyMergePatch applies an RFC 7386 merge patch to the target document
+func applyMergePatch(target any, patch any) any {
+	patchObject, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]any)
+	if !ok {
+		targetObject = make(map[string]any)
+	}
+
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+		targetObject[key] = applyMergePatch(targetObject[key], value)
+	}
+
+	return targetObject
+}
+
+// applyJSONPatch applies the RFC 6902 operations to the document in
+// order and stops at the first operation that fails
+func applyJSONPatch(document any, operations []patchOperation) (any, error) {
+	for i, operation := range operations {
+		var err error
+		document, err = applyPatchOperation(document, operation)
+		if err != nil {
+			if errors.Is(err, errPatchTestFailed) {
+				return nil, err
+			}
+			return nil, fmt.Errorf("patch operation %d (%s): %w", i, operation.Op, err)
+		}
+	}
+	return document, nil
+}
+
+func applyPatchOperation(document any, operation patchOperation) (any, error) {
+	path, err := parsePointer(operation.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	// value is required by add, replace and test
+	var value any
+	switch operation.Op {
+	case "add", "replace", "test":
+		if operation.Value == nil {
+			return nil, errors.New("missing value")
+		}
+		err = json.Unmarshal(operation.Value, &value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch operation.Op {
+	case "add":
+		return pointerAdd(document, path, value)
+	case "remove":
+		document, _, err = pointerRemove(document, path)
+		return document, err
+	case "replace":
+		if len(path) == 0 {
+			return value, nil
+		}
+		document, _, err = pointerRemove(document, path)
+		if err != nil {
+			return nil, err
+		}
+		return pointerAdd(document, path, value)
+	case "move", "copy":
+		from, err := parsePointer(operation.From)
+		if err != nil {
+			return nil, err
+		}
+		var moved any
+		if operation.Op == "move" {
+			if len(path) > len(from) && hasPathPrefix(path, from) {
+				return nil, errors.New("a value cannot be moved into one of its children")
+			}
+			document, moved, err = pointerRemove(document, from)
+		} else {
+			moved, err = pointerGet(document, from)
+			moved = deepCopy(moved)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return pointerAdd(document, path, moved)
+	case "test":
+		actual, err := pointerGet(document, path)
+		if err != nil || !reflect.DeepEqual(actual, value) {
+			return nil, errPatchTestFailed
+		}
+		return document, nil
+	default:
+		return nil, fmt.Errorf("unknown op %q", operation.Op)
+	}
+}
+
+// parsePointer splits an RFC 6901 JSON pointer into its reference tokens
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid path %q", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+	return tokens, nil
+}
+
+// pointerGet returns the value the path points to
+func pointerGet(node any, path []string) (any, error) {
+	for _, token := range path {
+		switch container := node.(type) {
+		case map[string]any:
+			child, ok := container[token]
+			if !ok {
+				return nil, fmt.Errorf("path member %q does not exist", token)
+			}
+			node = child
+		case []any:
+			index, err := arrayIndex(token, len(container)-1)
+			if err != nil {
+				return nil, err
+			}
+			node = container[index]
+		default:
+			return nil, fmt.Errorf("path member %q does not exist", token)
+		}
+	}
+	return node, nil
+}
+
+// pointerAdd adds value at path and returns the updated node
+func pointerAdd(node any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	token := path[0]
+	switch container := node.(type) {
+	case map[string]any:
+		if len(path) == 1 {
+			container[token] = value
+			return container, nil
+		}
+		child, ok := container[token]
+		if !ok {
+			return nil, fmt.Errorf("path member %q does not exist", token)
+		}
+		child, err := pointerAdd(child, path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		container[token] = child
+		return container, nil
+	case []any:
+		if len(path) == 1 {
+			index := len(container)
+			if token != "-" {
+				var err error
+				index, err = arrayIndex(token, len(container))
+				if err != nil {
+					return nil, err
+				}
+			}
+			container = append(container, nil)
+			copy(container[index+1:], container[index:])
+			container[index] = value
+			return container, nil
+		}
+		index, err := arrayIndex(token, len(container)-1)
+		if err != nil {
+			return nil, err
+		}
+		child, err := pointerAdd(container[index], path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		container[index] = child
+		return container, nil
+	default:
+		return nil, fmt.Errorf("path member %q does not exist", token)
+	}
+}
+
+// pointerRemove removes the value at path and returns the updated node
+// along with the removed value
+func pointerRemove(node any, path []string) (any, any, error) {
+	if len(path) == 0 {
+		return nil, nil, errors.New("the whole document cannot be removed")
+	}
+
+	token := path[0]
+	switch container := node.(type) {
+	case map[string]any:
+		child, ok := container[token]
+		if !ok {
+			return nil, nil, fmt.Errorf("path member %q does not exist", token)
+		}
+		if len(path) == 1 {
+			delete(container, token)
+			return container, child, nil
+		}
+		child, removed, err := pointerRemove(child, path[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		container[token] = child
+		return container, removed, nil
+	case []any:
+		index, err := arrayIndex(token, len(container)-1)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(path) == 1 {
+			removed := container[index]
+			return append(container[:index], container[index+1:]...), removed, nil
+		}
+		child, removed, err := pointerRemove(container[index], path[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		container[index] = child
+		return container, removed, nil
+	default:
+		return nil, nil, fmt.Errorf("path member %q does not exist", token)
+	}
+}
+
+// arrayIndex parses an array index token, which must not exceed last
+func arrayIndex(token string, last int) (int, error) {
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || index > last || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	return index, nil
+}
+
+// hasPathPrefix reports whether path starts with all of prefix
+func hasPathPrefix(path []string, prefix []string) bool {
+	for i := range prefix {
+		if path[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// deepCopy copies a generic JSON value so that a copied value does not
+// share maps or slices with its source
+func deepCopy(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		copied := make(map[string]any, len(v))
+		for key, child := range v {
+			copied[key] = deepCopy(child)
+		}
+		return copied
+	case []any:
+		copied := make([]any, len(v))
+		for i, child := range v {
+			copied[i] = deepCopy(child)
+		}
+		return copied
+	default:
+		return v
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParsePointer(t *testing.T) {
+	tests := []struct {
+		pointer string
+		want    []string
+		wantErr bool
+	}{
+		{pointer: "", want: nil},
+		{pointer: "/", want: []string{""}},
+		{pointer: "/content", want: []string{"content"}},
+		{pointer: "/a/0/b", want: []string{"a", "0", "b"}},
+		{pointer: "/a~1b", want: []string{"a/b"}},
+		{pointer: "/m~0n", want: []string{"m~n"}},
+		// ~01 is "~1" and not "/": ~1 is decoded before ~0
+		{pointer: "/~01", want: []string{"~1"}},
+		{pointer: "content", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parsePointer(tt.pointer)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parsePointer(%q) error = %v, want error %t", tt.pointer, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parsePointer(%q) = %q, want %q", tt.pointer, got, tt.want)
+		}
+	}
+}
+
+func TestApplyJSONPatch(t *testing.T) {
+	const document = `{"rating": 4, "content": "good", "tags": ["a", "b", "c"], "meta": {"x": 1}}`
+
+	tests := []struct {
+		name    string
+		patch   string
+		want    string
+		wantErr error // the error a failed patch must match, if any
+		failed  bool
+	}{
+		{
+			name:  "replace a member",
+			patch: `[{"op": "replace", "path": "/content", "value": "great"}]`,
+			want:  `{"rating": 4, "content": "great", "tags": ["a", "b", "c"], "meta": {"x": 1}}`,
+		},
+		{
+			name:  "add a member",
+			patch: `[{"op": "add", "path": "/meta/y", "value": 2}]`,
+			want:  `{"rating": 4, "content": "good", "tags": ["a", "b", "c"], "meta": {"x": 1, "y": 2}}`,
+		},
+		{
+			name:  "add inside an array",
+			patch: `[{"op": "add", "path": "/tags/1", "value": "z"}]`,
+			want:  `{"rating": 4, "content": "good", "tags": ["a", "z", "b", "c"], "meta": {"x": 1}}`,
+		},
+		{
+			name:  "append to an array",
+			patch: `[{"op": "add", "path": "/tags/-", "value": "z"}]`,
+			want:  `{"rating": 4, "content": "good", "tags": ["a", "b", "c", "z"], "meta": {"x": 1}}`,
+		},
+		{
+			name:  "add at the end index of an array",
+			patch: `[{"op": "add", "path": "/tags/3", "value": "z"}]`,
+			want:  `{"rating": 4, "content": "good", "tags": ["a", "b", "c", "z"], "meta": {"x": 1}}`,
+		},
+		{
+			name:   "add past the end of an array",
+			patch:  `[{"op": "add", "path": "/tags/4", "value": "z"}]`,
+			failed: true,
+		},
+		{
+			name:  "remove from an array",
+			patch: `[{"op": "remove", "path": "/tags/0"}]`,
+			want:  `{"rating": 4, "content": "good", "tags": ["b", "c"], "meta": {"x": 1}}`,
+		},
+		{
+			name:  "remove a member",
+			patch: `[{"op": "remove", "path": "/meta"}]`,
+			want:  `{"rating": 4, "content": "good", "tags": ["a", "b", "c"]}`,
+		},
+		{
+			name:   "remove a missing member",
+			patch:  `[{"op": "remove", "path": "/missing"}]`,
+			failed: true,
+		},
+		{
+			name:   "remove with a leading zero index",
+			patch:  `[{"op": "remove", "path": "/tags/01"}]`,
+			failed: true,
+		},
+		{
+			name:  "move within an array",
+			patch: `[{"op": "move", "from": "/tags/0", "path": "/tags/2"}]`,
+			want:  `{"rating": 4, "content": "good", "tags": ["b", "c", "a"], "meta": {"x": 1}}`,
+		},
+		{
+			name:  "move a member",
+			patch: `[{"op": "move", "from": "/meta/x", "path": "/rating"}]`,
+			want:  `{"rating": 1, "content": "good", "tags": ["a", "b", "c"], "meta": {}}`,
+		},
+		{
+			name:   "move into a child",
+			patch:  `[{"op": "move", "from": "/meta", "path": "/meta/inner"}]`,
+			failed: true,
+		},
+		{
+			name:  "copy an array element",
+			patch: `[{"op": "copy", "from": "/tags/2", "path": "/tags/0"}]`,
+			want:  `{"rating": 4, "content": "good", "tags": ["c", "a", "b", "c"], "meta": {"x": 1}}`,
+		},
+		{
+			// the copy must not share the map with its source
+			name:  "copy then change the copy",
+			patch: `[{"op": "copy", "from": "/meta", "path": "/other"}, {"op": "replace", "path": "/other/x", "value": 2}]`,
+			want:  `{"rating": 4, "content": "good", "tags": ["a", "b", "c"], "meta": {"x": 1}, "other": {"x": 2}}`,
+		},
+		{
+			name:  "escaped member names",
+			patch: `[{"op": "add", "path": "/meta/a~1b", "value": 1}, {"op": "add", "path": "/meta/m~0n", "value": 2}]`,
+			want:  `{"rating": 4, "content": "good", "tags": ["a", "b", "c"], "meta": {"x": 1, "a/b": 1, "m~n": 2}}`,
+		},
+		{
+			name:  "test then replace",
+			patch: `[{"op": "test", "path": "/rating", "value": 4}, {"op": "replace", "path": "/rating", "value": 5}]`,
+			want:  `{"rating": 5, "content": "good", "tags": ["a", "b", "c"], "meta": {"x": 1}}`,
+		},
+		{
+			name:    "failed test",
+			patch:   `[{"op": "test", "path": "/rating", "value": 3}, {"op": "replace", "path": "/rating", "value": 5}]`,
+			failed:  true,
+			wantErr: errPatchTestFailed,
+		},
+		{
+			name:    "test of a missing member",
+			patch:   `[{"op": "test", "path": "/missing", "value": 3}]`,
+			failed:  true,
+			wantErr: errPatchTestFailed,
+		},
+		{
+			name:   "missing value",
+			patch:  `[{"op": "replace", "path": "/rating"}]`,
+			failed: true,
+		},
+		{
+			name:   "unknown op",
+			patch:  `[{"op": "swap", "path": "/rating"}]`,
+			failed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var doc any
+			if err := json.Unmarshal([]byte(document), &doc); err != nil {
+				t.Fatal(err)
+			}
+			var operations []patchOperation
+			if err := json.Unmarshal([]byte(tt.patch), &operations); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := applyJSONPatch(doc, operations)
+			if tt.failed {
+				if err == nil {
+					t.Fatalf("got %v, want an error", got)
+				}
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got error %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var want any
+			if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestApplyMergePatch(t *testing.T) {
+	// examples from RFC 7386, appendix A
+	tests := []struct {
+		target string
+		patch  string
+		want   string
+	}{
+		{`{"a": "b"}`, `{"a": "c"}`, `{"a": "c"}`},
+		{`{"a": "b"}`, `{"b": "c"}`, `{"a": "b", "b": "c"}`},
+		{`{"a": "b"}`, `{"a": null}`, `{}`},
+		{`{"a": "b", "b": "c"}`, `{"a": null}`, `{"b": "c"}`},
+		{`{"a": ["b"]}`, `{"a": "c"}`, `{"a": "c"}`},
+		{`{"a": "c"}`, `{"a": ["b"]}`, `{"a": ["b"]}`},
+		{`{"a": {"b": "c"}}`, `{"a": {"b": "d", "c": null}}`, `{"a": {"b": "d"}}`},
+		{`{"a": [{"b": "c"}]}`, `{"a": [1]}`, `{"a": [1]}`},
+		{`["a", "b"]`, `["c", "d"]`, `["c", "d"]`},
+		{`{"a": "b"}`, `["c"]`, `["c"]`},
+		{`{"a": "foo"}`, `null`, `null`},
+		{`{"a": "foo"}`, `"bar"`, `"bar"`},
+		{`{"e": null}`, `{"a": 1}`, `{"e": null, "a": 1}`},
+		{`[1, 2]`, `{"a": "b", "c": null}`, `{"a": "b"}`},
+		{`{}`, `{"a": {"bb": {"ccc": null}}}`, `{"a": {"bb": {}}}`},
+	}
+
+	for _, tt := range tests {
+		var target, patch, want any
+		for _, v := range []struct {
+			text string
+			dst  *any
+		}{{tt.target, &target}, {tt.patch, &patch}, {tt.want, &want}} {
+			if err := json.Unmarshal([]byte(v.text), v.dst); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		got := applyMergePatch(target, patch)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("merge %s into %s = %v, want %s", tt.patch, tt.target, got, tt.want)
+		}
+	}
+}
@@ -4,19 +4,27 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/georgie5/productReview/internal/data"
 	"github.com/georgie5/productReview/internal/validator"
 )
 
+// productInput holds the product fields a client is allowed to set
+type productInput struct {
+	Name     string `json:"name"`
+	Category string `json:"category"`
+	ImageURL string `json:"image_url"`
+}
+
+// errDuplicateProduct is reported when a product is given the name and
+// category of another product, which together identify a product
+var errDuplicateProduct = errors.New("a product with this name and category already exists")
+
 func (a *applicationDependencies) createProductHandler(w http.ResponseWriter, r *http.Request) {
 
 	//create a struct to hold a product
-	var incomingData struct {
-		Name     string `json:"name"`
-		Category string `json:"category"`
-		ImageURL string `json:"image_url"`
-	}
+	var incomingData productInput
 
 	err := a.readJSON(w, r, &incomingData)
 	if err != nil {
@@ -42,7 +50,12 @@ func (a *applicationDependencies) createProductHandler(w http.ResponseWriter, r
 	//Add product to the database table
 	err = a.productModel.Insert(product)
 	if err != nil {
-		a.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrDuplicateRecord):
+			a.conflictResponse(w, r, errDuplicateProduct)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
@@ -52,7 +65,7 @@ func (a *applicationDependencies) createProductHandler(w http.ResponseWriter, r
 	data := envelope{
 		"product": product,
 	}
-	err = a.writeJSON(w, http.StatusCreated, data, headers)
+	err = a.writeJSON(w, r, http.StatusCreated, data, headers)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 	}
@@ -86,7 +99,7 @@ func (a *applicationDependencies) displayProductHandler(w http.ResponseWriter, r
 	data := envelope{
 		"product": product,
 	}
-	err = a.writeJSON(w, http.StatusOK, data, nil)
+	err = a.writeJSON(w, r, http.StatusOK, data, nil)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 		return
@@ -112,31 +125,129 @@ func (a *applicationDependencies) updateProductHandler(w http.ResponseWriter, r
 		return
 	}
 
-	var incomingData struct {
-		Name     *string `json:"name"`     // Use pointers to allow partial updates
-		Category *string `json:"category"` // Pointers differentiate empty fields from absent ones
-		ImageURL *string `json:"image_url"`
+	// A PATCH body is either a plain JSON object holding only the fields
+	// to change, or a merge patch / JSON patch applied to the product
+	switch a.requestMediaType(r) {
+	case "application/json":
+		var incomingData struct {
+			Name     *string `json:"name"`     // Use pointers to allow partial updates
+			Category *string `json:"category"` // Pointers differentiate empty fields from absent ones
+			ImageURL *string `json:"image_url"`
+		}
+
+		err = a.readJSON(w, r, &incomingData)
+		if err != nil {
+			a.badRequestResponse(w, r, err)
+			return
+		}
+
+		// We need to now check the fields to see which ones need updating
+		// if incomingData.Content is nil, no update was provided
+		if incomingData.Name != nil {
+			product.Name = *incomingData.Name
+		}
+		if incomingData.Category != nil {
+			product.Category = *incomingData.Category
+		}
+		if incomingData.ImageURL != nil {
+			product.ImageURL = *incomingData.ImageURL
+		}
+	case mergePatchMediaType, jsonPatchMediaType:
+		incomingData := productInput{
+			Name:     product.Name,
+			Category: product.Category,
+			ImageURL: product.ImageURL,
+		}
+
+		err = a.readPatch(w, r, &incomingData)
+		if err != nil {
+			switch {
+			case errors.Is(err, errPatchTestFailed):
+				a.conflictResponse(w, r, err)
+			default:
+				a.badRequestResponse(w, r, err)
+			}
+			return
+		}
+
+		product.Name = incomingData.Name
+		product.Category = incomingData.Category
+		product.ImageURL = incomingData.ImageURL
+	default:
+		a.unsupportedMediaTypeResponse(w, r)
+		return
+	}
+
+	// Before we write the updates to the DB let's validate
+	v := validator.New()
+	data.ValidateProduct(v, product)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
 	}
 
-	err = a.readJSON(w, r, &incomingData)
+	// Save the updated product in the database
+	err = a.productModel.Update(product)
 	if err != nil {
-		a.badRequestResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			a.editConflictResponse(w, r)
+		case errors.Is(err, data.ErrDuplicateRecord):
+			a.conflictResponse(w, r, errDuplicateProduct)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
-	// We need to now check the fields to see which ones need updating
-	// if incomingData.Content is nil, no update was provided
-	if incomingData.Name != nil {
-		product.Name = *incomingData.Name
+	//Send a JSON response with the updated product
+	data := envelope{
+		"product": product,
 	}
-	if incomingData.Category != nil {
-		product.Category = *incomingData.Category
+	err = a.writeJSON(w, r, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
 	}
-	if incomingData.ImageURL != nil {
-		product.ImageURL = *incomingData.ImageURL
+
+}
+
+// replaceProductHandler replaces every editable field of a product, so
+// fields missing from the body are cleared rather than left unchanged
+func (a *applicationDependencies) replaceProductHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r, "prod_id")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
 	}
 
-	// Before we write the updates to the DB let's validate
+	product, err := a.productModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if a.requestMediaType(r) != "application/json" {
+		a.unsupportedMediaTypeResponse(w, r)
+		return
+	}
+
+	var incomingData productInput
+	err = a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	product.Name = incomingData.Name
+	product.Category = incomingData.Category
+	product.ImageURL = incomingData.ImageURL
+
 	v := validator.New()
 	data.ValidateProduct(v, product)
 	if !v.IsEmpty() {
@@ -144,23 +255,26 @@ func (a *applicationDependencies) updateProductHandler(w http.ResponseWriter, r
 		return
 	}
 
-	// Save the updated product in the database
 	err = a.productModel.Update(product)
 	if err != nil {
-		a.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			a.editConflictResponse(w, r)
+		case errors.Is(err, data.ErrDuplicateRecord):
+			a.conflictResponse(w, r, errDuplicateProduct)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
-	//Send a JSON response with the updated product
 	data := envelope{
 		"product": product,
 	}
-	err = a.writeJSON(w, http.StatusOK, data, nil)
+	err = a.writeJSON(w, r, http.StatusOK, data, nil)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
-		return
 	}
-
 }
 
 func (a *applicationDependencies) deleteProductHandler(w http.ResponseWriter, r *http.Request) {
@@ -171,6 +285,21 @@ func (a *applicationDependencies) deleteProductHandler(w http.ResponseWriter, r
 		return
 	}
 
+	// the images go with the product, their files are removed once it is
+	// deleted unless another product has the same image
+	images, err := a.productImageModel.GetForProduct(id)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// so do the reviews and their photos
+	reviewMedia, err := a.mediaModel.GetForProduct(id)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
 	err = a.productModel.Delete(id)
 
 	if err != nil {
@@ -183,11 +312,14 @@ func (a *applicationDependencies) deleteProductHandler(w http.ResponseWriter, r
 		return
 	}
 
+	a.deleteProductImageFiles(images...)
+	a.deleteBlobs(data.MediaKeys(reviewMedia...)...)
+
 	// display the comment
 	data := envelope{
 		"message": "product successfully deleted",
 	}
-	err = a.writeJSON(w, http.StatusOK, data, nil)
+	err = a.writeJSON(w, r, http.StatusOK, data, nil)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 	}
@@ -197,24 +329,37 @@ func (a *applicationDependencies) deleteProductHandler(w http.ResponseWriter, r
 func (a *applicationDependencies) listProductHandler(w http.ResponseWriter, r *http.Request) {
 
 	var queryParametersData struct {
-		Name     string
-		Category string
+		Name       string
+		Categories []string
+		IDs        []int64
 		data.Filters
 	}
 
+	v := validator.New()
+
 	// get the query parameters from the URL
 	query := r.URL.Query()
 	queryParametersData.Name = a.getSingleQueryParameter(query, "name", "")
-	queryParametersData.Category = a.getSingleQueryParameter(query, "category", "")
+	queryParametersData.IDs = a.getMultipleIntegerParameters(query, "ids", nil, v)
+	for _, category := range a.getMultipleQueryParameters(query, "category", nil) {
+		category = strings.TrimSpace(category)
+		if category != "" {
+			queryParametersData.Categories = append(queryParametersData.Categories, category)
+		}
+	}
 
-	v := validator.New()
+	// a batch lookup by ids ignores the other filters and pagination
+	if queryParametersData.IDs != nil {
+		a.batchProductsResponse(w, r, queryParametersData.IDs, v)
+		return
+	}
 
 	// Set pagination and sorting
 	queryParametersData.Filters.Page = a.getSingleIntegerParameter(query, "page", 1, v)
 	queryParametersData.Filters.PageSize = a.getSingleIntegerParameter(query, "page_size", 10, v)
 
 	queryParametersData.Filters.Sort = a.getSingleQueryParameter(query, "sort", "id")
-	queryParametersData.Filters.SortSafeList = []string{"id", "name", "category", "-id", "-name", "-category"}
+	queryParametersData.Filters.SortSafeList = []string{"id", "name", "category", "average_rating", "-id", "-name", "-category", "-average_rating"}
 
 	// Validate the filters
 	data.ValidateFilters(v, queryParametersData.Filters)
@@ -224,18 +369,46 @@ func (a *applicationDependencies) listProductHandler(w http.ResponseWriter, r *h
 	}
 
 	// Fetch products from the database
-	products, metadata, err := a.productModel.GetAll(queryParametersData.Name, queryParametersData.Category, queryParametersData.Filters)
+	products, metadata, err := a.productModel.GetAll(queryParametersData.Name, queryParametersData.Categories, queryParametersData.Filters)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 		return
 	}
 
-	//Send the JSON response
+	//Send the JSON response along with links to the other pages
+	links, headers := a.paginate(r, metadata)
 	data := envelope{
 		"products":  products,
 		"@metadata": metadata,
+		"links":     links,
+	}
+	err = a.writeJSON(w, r, http.StatusOK, data, headers)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// batchProductsResponse sends the products with the given ids in the
+// order they were requested and lists the ids that were not found
+func (a *applicationDependencies) batchProductsResponse(w http.ResponseWriter, r *http.Request, ids []int64, v *validator.Validator) {
+
+	data.ValidateIDs(v, "ids", ids)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	products, missing, err := a.productModel.GetByIDs(ids)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"products":    products,
+		"missing_ids": missing,
 	}
-	err = a.writeJSON(w, http.StatusOK, data, nil)
+	err = a.writeJSON(w, r, http.StatusOK, data, nil)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 	}
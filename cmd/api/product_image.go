@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/georgie5/productReview/internal/data"
+	"github.com/georgie5/productReview/internal/media"
+	"github.com/georgie5/productReview/internal/validator"
+)
+
+// The largest width or height of the medium and large variants of a
+// product image, the thumb variant uses -media-thumbnail-size
+const (
+	productImageMediumSize = 800
+	productImageLargeSize  = 1600
+)
+
+// readProductParam fetches the product named in the URL
+func (a *applicationDependencies) readProductParam(w http.ResponseWriter, r *http.Request) (*data.Product, bool) {
+	productID, err := a.readIDParam(r, "prod_id")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	product, err := a.productModel.Get(productID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return product, true
+}
+
+// readProductImageParams fetches the product image named in the URL
+func (a *applicationDependencies) readProductImageParams(w http.ResponseWriter, r *http.Request) (*data.ProductImage, bool) {
+	productID, err := a.readIDParam(r, "prod_id")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	imageID, err := a.readIDParam(r, "image_id")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	image, err := a.productImageModel.Get(productID, imageID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return image, true
+}
+
+// uploadProductImagesHandler adds the images sent as "file" parts of a
+// multipart/form-data request after the other images of a product. An
+// image the product already has is not added twice.
+func (a *applicationDependencies) uploadProductImagesHandler(w http.ResponseWriter, r *http.Request) {
+	product, ok := a.readProductParam(w, r)
+	if !ok {
+		return
+	}
+
+	limitMessage := fmt.Sprintf("a product can have at most %d images", a.config.media.maxPerProduct)
+	images, ok := a.readImageUploads(w, r, a.config.media.maxPerProduct-len(product.Images), limitMessage)
+	if !ok {
+		return
+	}
+
+	stored := []*data.ProductImage{}
+	for _, img := range images {
+		image, err := a.storeProductImage(r.Context(), product.ID, img)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrLimitReached):
+				a.failedValidationResponse(w, r, map[string]string{"file": limitMessage})
+			case errors.Is(err, data.ErrRecordNotFound):
+				a.notFoundResponse(w, r)
+			default:
+				a.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		stored = append(stored, image)
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/products/%d/images", product.ID))
+	err := a.writeJSON(w, r, http.StatusCreated, envelope{"images": stored}, headers)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// storeProductImage saves an image and its variants under keys made of
+// the hash of the image, so the same image is stored once whichever
+// product it belongs to, and records it for the product. It returns
+// data.ErrLimitReached when the product has no room left for it.
+func (a *applicationDependencies) storeProductImage(ctx context.Context, productID int64, img *media.Image) (*data.ProductImage, error) {
+	hash := media.ContentHash(img.Data)
+
+	existing, err := a.productImageModel.GetByHash(productID, hash)
+	if err == nil {
+		return existing, nil
+	}
+	if !errors.Is(err, data.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	image := &data.ProductImage{
+		ProductID:   productID,
+		Hash:        hash,
+		ContentType: img.ContentType,
+		Width:       img.Width,
+		Height:      img.Height,
+		Size:        int64(len(img.Data)),
+	}
+
+	variants := []struct {
+		name string
+		size int
+		key  *string
+	}{
+		{"original", 0, &image.Keys.Original},
+		{"thumb", a.config.media.thumbnailSize, &image.Keys.Thumb},
+		{"medium", productImageMediumSize, &image.Keys.Medium},
+		{"large", productImageLargeSize, &image.Keys.Large},
+	}
+	// resize before the product is locked, only the writes happen while
+	// it is held
+	files := make([]*media.Image, len(variants))
+	for i, variant := range variants {
+		files[i] = img
+		if variant.size > 0 {
+			files[i], err = img.Resize(variant.size)
+			if err != nil {
+				return nil, err
+			}
+		}
+		*variant.key = media.HashKey("products", hash, variant.name, files[i].Ext())
+	}
+
+	writeFiles := func(ctx context.Context) error {
+		// the same hash always holds the same files, so writing over
+		// them is harmless
+		for i, variant := range variants {
+			err := a.blobStore.Put(ctx, *variant.key, bytes.NewReader(files[i].Data))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	err = a.productImageModel.Insert(image, a.config.media.maxPerProduct, writeFiles)
+	if err != nil {
+		if errors.Is(err, data.ErrDuplicateRecord) {
+			// a concurrent upload of the same image got there first
+			return a.productImageModel.GetByHash(productID, hash)
+		}
+		// the files may have been written before the product turned out
+		// to be full or deleted, they are only deleted if no image uses
+		// them
+		a.deleteProductImageFiles(image)
+		return nil, err
+	}
+
+	return image, nil
+}
+
+// deleteProductImageFiles removes the files of images in the background,
+// unless another image with the same hash still uses them. The check and
+// the delete hold the lock on the hash, so an upload of the same image
+// cannot record it in between.
+func (a *applicationDependencies) deleteProductImageFiles(images ...*data.ProductImage) {
+	if len(images) == 0 {
+		return
+	}
+
+	a.background(func() {
+		for _, image := range images {
+			err := a.productImageModel.DeleteUnusedFiles(image.Hash, func(ctx context.Context) error {
+				for _, key := range image.Keys.All() {
+					if key == "" {
+						continue
+					}
+					err := a.blobStore.Delete(ctx, key)
+					if err != nil && !errors.Is(err, media.ErrNotFound) {
+						a.logger.Error("deleting product image", "key", key, "error", err.Error())
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				a.logger.Error("deleting product image", "hash", image.Hash, "error", err.Error())
+			}
+		}
+	})
+}
+
+// listProductImagesHandler lists the images of a product in order
+func (a *applicationDependencies) listProductImagesHandler(w http.ResponseWriter, r *http.Request) {
+	product, ok := a.readProductParam(w, r)
+	if !ok {
+		return
+	}
+
+	err := a.writeJSON(w, r, http.StatusOK, envelope{"images": product.Images}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateProductImageHandler moves an image to another position and/or
+// makes it the primary image of its product
+func (a *applicationDependencies) updateProductImageHandler(w http.ResponseWriter, r *http.Request) {
+	image, ok := a.readProductImageParams(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Position *int  `json:"position"`
+		Primary  *bool `json:"primary"`
+	}
+
+	err := a.readJSON(w, r, &input)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Position != nil || input.Primary != nil, "body", "must set position or primary")
+	if input.Position != nil {
+		v.Check(*input.Position >= 1, "position", "must be greater than zero")
+	}
+	if input.Primary != nil {
+		v.Check(*input.Primary || !image.Primary, "primary", "make another image primary instead")
+	}
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if input.Position != nil {
+		err = a.productImageModel.Move(image, *input.Position)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				a.notFoundResponse(w, r)
+			default:
+				a.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+	}
+
+	if input.Primary != nil && *input.Primary && !image.Primary {
+		err = a.productImageModel.SetPrimary(image)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				a.notFoundResponse(w, r)
+			default:
+				a.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+	}
+
+	err = a.writeJSON(w, r, http.StatusOK, envelope{"image": image}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteProductImageHandler removes an image from a product. The next
+// image becomes primary when the primary image is deleted.
+func (a *applicationDependencies) deleteProductImageHandler(w http.ResponseWriter, r *http.Request) {
+	image, ok := a.readProductImageParams(w, r)
+	if !ok {
+		return
+	}
+
+	err := a.productImageModel.Delete(image)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	a.deleteProductImageFiles(image)
+
+	err = a.writeJSON(w, r, http.StatusOK, envelope{"message": "image successfully deleted"}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
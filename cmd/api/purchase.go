@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/georgie5/productReview/internal/data"
+	"github.com/georgie5/productReview/internal/validator"
+)
+
+// The most purchases a single import request can hold
+const maxPurchasesPerImport = 1000
+
+// importPurchasesHandler stores a batch of purchases from the order
+// system. The batch is rejected as a whole when any purchase is invalid,
+// and purchases imported before are skipped, so a batch can be sent again.
+func (a *applicationDependencies) importPurchasesHandler(w http.ResponseWriter, r *http.Request) {
+
+	var input struct {
+		Purchases []struct {
+			ProductID   int64     `json:"product_id"`
+			Email       string    `json:"email"`
+			OrderID     string    `json:"order_id"`
+			PurchasedAt time.Time `json:"purchased_at"`
+		} `json:"purchases"`
+	}
+
+	err := a.readJSON(w, r, &input)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(len(input.Purchases) > 0, "purchases", "must contain at least one purchase")
+	v.Check(len(input.Purchases) <= maxPurchasesPerImport, "purchases", fmt.Sprintf("must not contain more than %d purchases", maxPurchasesPerImport))
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// the errors of each purchase are reported under its index, such as
+	// "purchases[3].email"
+	purchases := make([]*data.Purchase, 0, len(input.Purchases))
+	productIDs := []int64{}
+	seen := make(map[int64]bool)
+	for i, in := range input.Purchases {
+		purchase := &data.Purchase{
+			ProductID:   in.ProductID,
+			Email:       data.NormalizeEmail(in.Email),
+			OrderID:     in.OrderID,
+			PurchasedAt: in.PurchasedAt,
+		}
+
+		pv := validator.New()
+		data.ValidatePurchase(pv, purchase)
+		for key, message := range pv.Errors {
+			v.AddError(fmt.Sprintf("purchases[%d].%s", i, key), message)
+		}
+
+		purchases = append(purchases, purchase)
+		if purchase.ProductID > 0 && !seen[purchase.ProductID] {
+			seen[purchase.ProductID] = true
+			productIDs = append(productIDs, purchase.ProductID)
+		}
+	}
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// the products must exist, in batches the size of a batch lookup
+	missing := make(map[int64]bool)
+	for start := 0; start < len(productIDs); start += 100 {
+		_, notFound, err := a.productModel.GetByIDs(productIDs[start:min(start+100, len(productIDs))])
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+		for _, id := range notFound {
+			missing[id] = true
+		}
+	}
+	for i, purchase := range purchases {
+		v.Check(!missing[purchase.ProductID], fmt.Sprintf("purchases[%d].product_id", i), "does not exist")
+	}
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	inserted, err := a.purchaseModel.InsertAll(purchases)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"inserted":         inserted,
+		"already_imported": len(purchases) - inserted,
+	}
+	err = a.writeJSON(w, r, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
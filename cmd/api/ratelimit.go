@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// rateLimitResult is the outcome of taking a token from a client's bucket
+type rateLimitResult struct {
+	allowed bool
+	tokens  float64 // tokens left in the bucket after this request
+}
+
+// rateLimiter keeps the token buckets of every client. A key names the
+// policy and the client, so one limiter holds the buckets of all policies.
+type rateLimiter interface {
+	// allow takes a token from the bucket of the key
+	allow(ctx context.Context, key string, policy rateLimitPolicy) (rateLimitResult, error)
+	// cleanup removes the buckets that were not used since the cutoff
+	cleanup(ctx context.Context, cutoff time.Time) error
+}
+
+// memoryRateLimiter keeps the buckets in a map. Every instance of the
+// API has its own buckets, and they are lost on restart.
+type memoryRateLimiter struct {
+	mu      sync.Mutex // use to synchronize the map
+	clients map[string]*memoryClient
+}
+
+type memoryClient struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time // remove map entries that are stale
+}
+
+func newMemoryRateLimiter() *memoryRateLimiter {
+	return &memoryRateLimiter{
+		clients: make(map[string]*memoryClient),
+	}
+}
+
+func (m *memoryRateLimiter) allow(ctx context.Context, key string, policy rateLimitPolicy) (rateLimitResult, error) {
+	m.mu.Lock() // exclusive access to the map
+	defer m.mu.Unlock()
+
+	// check if the key is already in the map, if not add it
+	client, found := m.clients[key]
+	if !found {
+		client = &memoryClient{limiter: rate.NewLimiter(rate.Limit(policy.rps), policy.burst)}
+		m.clients[key] = client
+	}
+
+	// Update the last seen for the client
+	client.lastSeen = time.Now()
+
+	allowed := client.limiter.Allow()
+	return rateLimitResult{allowed: allowed, tokens: client.limiter.Tokens()}, nil
+}
+
+func (m *memoryRateLimiter) cleanup(ctx context.Context, cutoff time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, client := range m.clients {
+		if client.lastSeen.Before(cutoff) {
+			delete(m.clients, key)
+		}
+	}
+	return nil
+}
+
+// postgresRateLimiter keeps the buckets in the rate_limits table, so the
+// limits hold across every instance of the API. The table is UNLOGGED:
+// losing the buckets in a database crash only resets the limits.
+type postgresRateLimiter struct {
+	DB *sql.DB
+}
+
+func (p postgresRateLimiter) allow(ctx context.Context, key string, policy rateLimitPolicy) (rateLimitResult, error) {
+	// The bucket is refilled for the time since its last update and a
+	// token is taken if one is available. The upsert locks the row, so
+	// concurrent requests for the same key are applied one at a time.
+	query := `
+		INSERT INTO rate_limits AS rl (key, tokens, allowed, updated_at)
+		VALUES ($1, $3::float8 - 1, $3::float8 >= 1, now())
+		ON CONFLICT (key) DO UPDATE SET
+			allowed = LEAST($3::float8, rl.tokens + EXTRACT(EPOCH FROM now() - rl.updated_at)::float8 * $2::float8) >= 1,
+			tokens = LEAST($3::float8, rl.tokens + EXTRACT(EPOCH FROM now() - rl.updated_at)::float8 * $2::float8)
+				- CASE WHEN LEAST($3::float8, rl.tokens + EXTRACT(EPOCH FROM now() - rl.updated_at)::float8 * $2::float8) >= 1 THEN 1 ELSE 0 END,
+			updated_at = now()
+		RETURNING allowed, tokens
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var result rateLimitResult
+	err := p.DB.QueryRowContext(ctx, query, key, policy.rps, float64(policy.burst)).Scan(&result.allowed, &result.tokens)
+	return result, err
+}
+
+func (p postgresRateLimiter) cleanup(ctx context.Context, cutoff time.Time) error {
+	query := `
+		DELETE FROM rate_limits
+		WHERE updated_at < $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := p.DB.ExecContext(ctx, query, cutoff)
+	return err
+}
+
+// cleanupRateLimiter removes stale buckets every minute until the
+// context is cancelled
+func (a *applicationDependencies) cleanupRateLimiter(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// delete any entry not seen in three minutes
+			err := a.limiter.cleanup(ctx, time.Now().Add(-3*time.Minute))
+			if err != nil && ctx.Err() == nil {
+				a.logger.Error("rate limiter cleanup failed", "error", err.Error())
+			}
+		}
+	}
+}
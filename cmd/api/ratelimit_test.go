@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryRateLimiter(t *testing.T) {
+	limiter := newMemoryRateLimiter()
+	ctx := context.Background()
+	policy := rateLimitPolicy{name: "global", rps: 0.001, burst: 2}
+
+	for i, want := range []bool{true, true, false} {
+		result, err := limiter.allow(ctx, "global:203.0.113.7", policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.allowed != want {
+			t.Errorf("request %d: allowed = %t, want %t", i+1, result.allowed, want)
+		}
+	}
+
+	// every key has its own bucket
+	result, err := limiter.allow(ctx, "global:203.0.113.8", policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.allowed {
+		t.Error("another client was limited by the first one's bucket")
+	}
+
+	err = limiter.cleanup(ctx, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(limiter.clients) != 0 {
+		t.Errorf("cleanup left %d buckets, want 0", len(limiter.clients))
+	}
+	// a removed bucket starts full again
+	result, err = limiter.allow(ctx, "global:203.0.113.7", policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.allowed {
+		t.Error("the client is still limited after its bucket was removed")
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/georgie5/productReview/internal/data"
+	"github.com/georgie5/productReview/internal/validator"
+)
+
+// reporterID identifies who reported a review, so one shopper counts once.
+// Shoppers have no accounts, so it is an HMAC of the client address,
+// which keeps the address itself out of the database. A plain hash would
+// not: every IPv4 address can be hashed to find the one that matches.
+func (a *applicationDependencies) reporterID(r *http.Request) string {
+	mac := hmac.New(sha256.New, []byte(a.config.reports.secret))
+	mac.Write([]byte(a.clientIP(r)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// createReportHandler lets a shopper report an abusive review. Reporting
+// the same review again does not count twice. Once enough shoppers have
+// reported it, the review is hidden until a moderator looks at it.
+func (a *applicationDependencies) createReportHandler(w http.ResponseWriter, r *http.Request) {
+	productID, err := a.readIDParam(r, "prod_id")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	reviewID, err := a.readIDParam(r, "review_id")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	review, err := a.reviewModel.Get(productID, reviewID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// only published reviews can be reported
+	if review.Status != data.ReviewStatusApproved {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Reason string `json:"reason"`
+		Note   string `json:"note"`
+	}
+
+	err = a.readJSON(w, r, &input)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	report := &data.Report{
+		ReviewID: review.ID,
+		Reporter: a.reporterID(r),
+		Reason:   strings.TrimSpace(input.Reason),
+		Note:     strings.TrimSpace(input.Note),
+	}
+
+	v := validator.New()
+	data.ValidateReport(v, report)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	inserted, err := a.reportModel.Insert(report)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// a repeated report changes nothing
+	if !inserted {
+		data := envelope{"message": "you have already reported this review"}
+		err = a.writeJSON(w, r, http.StatusOK, data, nil)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if a.config.reports.hideThreshold > 0 {
+		count, err := a.reportModel.CountUnresolved(review.ID)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if count >= a.config.reports.hideThreshold {
+			hidden, err := a.reviewModel.Hide(review.ID)
+			if err != nil {
+				a.serverErrorResponse(w, r, err)
+				return
+			}
+			// the review no longer counts toward the average rating
+			if hidden {
+				err = a.productModel.UpdateAverageRating(productID)
+				if err != nil {
+					a.serverErrorResponse(w, r, err)
+					return
+				}
+			}
+		}
+	}
+
+	data := envelope{"message": "thank you, the review was reported to the moderators"}
+	err = a.writeJSON(w, r, http.StatusCreated, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// listReportsHandler lists the reports for the moderators, the ones not
+// dealt with yet unless ?resolved=true or ?resolved=all
+func (a *applicationDependencies) listReportsHandler(w http.ResponseWriter, r *http.Request) {
+
+	var queryParametersData struct {
+		ReviewID int64
+		Resolved *bool
+		data.Filters
+	}
+
+	v := validator.New()
+	query := r.URL.Query()
+	queryParametersData.ReviewID = int64(a.getSingleIntegerParameter(query, "review_id", 0, v))
+
+	switch resolved := a.getSingleQueryParameter(query, "resolved", "false"); resolved {
+	case "all":
+		queryParametersData.Resolved = nil
+	default:
+		value, err := strconv.ParseBool(resolved)
+		if err != nil {
+			v.AddError("resolved", "must be true, false or all")
+		}
+		queryParametersData.Resolved = &value
+	}
+
+	queryParametersData.Filters.Page = a.getSingleIntegerParameter(query, "page", 1, v)
+	queryParametersData.Filters.PageSize = a.getSingleIntegerParameter(query, "page_size", 20, v)
+	queryParametersData.Filters.Sort = a.getSingleQueryParameter(query, "sort", "id")
+	queryParametersData.Filters.SortSafeList = []string{"id", "review_id", "reason", "-id", "-review_id", "-reason"}
+
+	v.Check(queryParametersData.ReviewID >= 0, "review_id", "must not be negative")
+	data.ValidateFilters(v, queryParametersData.Filters)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	reports, metadata, err := a.reportModel.GetAll(queryParametersData.ReviewID, queryParametersData.Resolved, queryParametersData.Filters)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	links, headers := a.paginate(r, metadata)
+	responseData := envelope{
+		"reports":   reports,
+		"@metadata": metadata,
+		"links":     links,
+	}
+	err = a.writeJSON(w, r, http.StatusOK, responseData, headers)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
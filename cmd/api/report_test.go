@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReporterID(t *testing.T) {
+	a := &applicationDependencies{}
+	a.config.reports.secret = strings.Repeat("k", 32)
+	other := &applicationDependencies{}
+	other.config.reports.secret = strings.Repeat("x", 32)
+
+	id := func(a *applicationDependencies, remoteAddr string) string {
+		r := httptest.NewRequest(http.MethodPost, "/v1/products/1/reviews/1/reports", nil)
+		r.RemoteAddr = remoteAddr
+		return a.reporterID(r)
+	}
+
+	first := id(a, "203.0.113.7:5000")
+	if len(first) != 64 {
+		t.Errorf("reporterID = %q, want 64 hex digits", first)
+	}
+	if strings.Contains(first, "203.0.113.7") {
+		t.Errorf("reporterID = %q contains the address", first)
+	}
+	// the port changes from one connection to the next
+	if got := id(a, "203.0.113.7:6000"); got != first {
+		t.Errorf("reporterID from another port = %q, want %q", got, first)
+	}
+	if got := id(a, "203.0.113.8:5000"); got == first {
+		t.Errorf("reporterID of another address = %q, want a different id", got)
+	}
+	if got := id(other, "203.0.113.7:5000"); got == first {
+		t.Errorf("reporterID with another secret = %q, want a different id", got)
+	}
+}
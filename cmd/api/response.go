@@ -0,0 +1,232 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/georgie5/productReview/internal/data"
+	"github.com/georgie5/productReview/internal/validator"
+)
+
+// responseInput holds the response fields the merchant is allowed to set
+type responseInput struct {
+	Author  string `json:"author"`
+	Content string `json:"content"`
+}
+
+// readReviewParams returns the review named in the URL, after sending a
+// 404 when the product has no such review
+func (a *applicationDependencies) readReviewParams(w http.ResponseWriter, r *http.Request) (*data.Review, bool) {
+	productID, err := a.readIDParam(r, "prod_id")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	reviewID, err := a.readIDParam(r, "review_id")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	review, err := a.reviewModel.Get(productID, reviewID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return review, true
+}
+
+// displayResponseHandler shows the merchant response of a published
+// review
+func (a *applicationDependencies) displayResponseHandler(w http.ResponseWriter, r *http.Request) {
+	review, ok := a.readPublishedReview(w, r)
+	if !ok {
+		return
+	}
+
+	response, err := a.responseModel.Get(review.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{"response": response}
+	err = a.writeJSON(w, r, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// createResponseHandler adds the official merchant response to a review
+func (a *applicationDependencies) createResponseHandler(w http.ResponseWriter, r *http.Request) {
+	review, ok := a.readReviewParams(w, r)
+	if !ok {
+		return
+	}
+
+	var input responseInput
+	err := a.readJSON(w, r, &input)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	response := &data.ReviewResponse{
+		ReviewID: review.ID,
+		Author:   input.Author,
+		Content:  input.Content,
+	}
+
+	v := validator.New()
+	data.ValidateResponse(v, response)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.responseModel.Insert(response)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateRecord):
+			a.conflictResponse(w, r, errors.New("the review already has a response, update it instead"))
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/products/%d/reviews/%d/response", review.ProductID, review.ID))
+
+	data := envelope{"response": response}
+	err = a.writeJSON(w, r, http.StatusCreated, data, headers)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateResponseHandler changes the merchant response of a review, with
+// the same kinds of PATCH body as reviews
+func (a *applicationDependencies) updateResponseHandler(w http.ResponseWriter, r *http.Request) {
+	review, ok := a.readReviewParams(w, r)
+	if !ok {
+		return
+	}
+
+	response, err := a.responseModel.Get(review.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	switch a.requestMediaType(r) {
+	case "application/json":
+		var input struct {
+			Author  *string `json:"author"`
+			Content *string `json:"content"`
+		}
+
+		err = a.readJSON(w, r, &input)
+		if err != nil {
+			a.badRequestResponse(w, r, err)
+			return
+		}
+
+		if input.Author != nil {
+			response.Author = *input.Author
+		}
+		if input.Content != nil {
+			response.Content = *input.Content
+		}
+	case mergePatchMediaType, jsonPatchMediaType:
+		input := responseInput{
+			Author:  response.Author,
+			Content: response.Content,
+		}
+
+		err = a.readPatch(w, r, &input)
+		if err != nil {
+			switch {
+			case errors.Is(err, errPatchTestFailed):
+				a.conflictResponse(w, r, err)
+			default:
+				a.badRequestResponse(w, r, err)
+			}
+			return
+		}
+
+		response.Author = input.Author
+		response.Content = input.Content
+	default:
+		a.unsupportedMediaTypeResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	data.ValidateResponse(v, response)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.responseModel.Update(response)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			a.editConflictResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{"response": response}
+	err = a.writeJSON(w, r, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+func (a *applicationDependencies) deleteResponseHandler(w http.ResponseWriter, r *http.Request) {
+	review, ok := a.readReviewParams(w, r)
+	if !ok {
+		return
+	}
+
+	err := a.responseModel.Delete(review.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"message": "response successfully deleted",
+	}
+	err = a.writeJSON(w, r, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
@@ -8,6 +8,12 @@ import (
 	"github.com/georgie5/productReview/internal/validator"
 )
 
+// reviewInput holds the review fields a client is allowed to set
+type reviewInput struct {
+	Rating  int    `json:"rating"`
+	Content string `json:"content"`
+}
+
 func (a *applicationDependencies) createReviewHandler(w http.ResponseWriter, r *http.Request) {
 	//Get the product_id from the URL to associate the review with a specific product.
 	productID, err := a.readIDParam(r, "prod_id")
@@ -16,9 +22,23 @@ func (a *applicationDependencies) createReviewHandler(w http.ResponseWriter, r *
 		return
 	}
 
+	// the product decides whether the review waits for a moderator
+	product, err := a.productModel.Get(productID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// the email and order id of the reviewer are only used to verify
+	// their purchase, they are not stored with the review
 	var input struct {
-		Rating  int    `json:"rating"`
-		Content string `json:"content"`
+		reviewInput
+		Purchase *data.PurchaseProof `json:"purchase"`
 	}
 	err = a.readJSON(w, r, &input)
 	if err != nil {
@@ -31,18 +51,29 @@ func (a *applicationDependencies) createReviewHandler(w http.ResponseWriter, r *
 		Rating:       input.Rating,
 		Content:      input.Content,
 		HelpfulCount: 0,
+		Status:       data.ReviewStatusApproved,
+	}
+	if a.moderationRequired(product) {
+		review.Status = data.ReviewStatusPending
 	}
 
 	// Validate the review data
 	v := validator.New()
 	data.ValidateReview(v, review)
+	if input.Purchase != nil {
+		data.ValidatePurchaseProof(v, input.Purchase)
+	}
 	if !v.IsEmpty() {
 		a.failedValidationResponse(w, r, v.Errors)
 		return
 	}
+	if !a.screenReview(w, r, review) {
+		return
+	}
+	a.scoreSentiment(review)
 
 	// Insert the review into the database
-	err = a.reviewModel.Insert(review)
+	err = a.reviewModel.Insert(review, input.Purchase)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 		return
@@ -59,7 +90,7 @@ func (a *applicationDependencies) createReviewHandler(w http.ResponseWriter, r *
 	data := envelope{
 		"review": review,
 	}
-	err = a.writeJSON(w, http.StatusCreated, data, nil)
+	err = a.writeJSON(w, r, http.StatusCreated, data, nil)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 	}
@@ -91,11 +122,17 @@ func (a *applicationDependencies) displayReviewHandler(w http.ResponseWriter, r
 		return
 	}
 
+	// reviews are only public once a moderator approved them
+	if review.Status != data.ReviewStatusApproved {
+		a.notFoundResponse(w, r)
+		return
+	}
+
 	// Send the JSON response with the review details
 	data := envelope{
 		"review": review,
 	}
-	err = a.writeJSON(w, http.StatusOK, data, nil)
+	err = a.writeJSON(w, r, http.StatusOK, data, nil)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 	}
@@ -124,24 +161,58 @@ func (a *applicationDependencies) updateReviewHandler(w http.ResponseWriter, r *
 		}
 		return
 	}
+	original := *review
 
-	var input struct {
-		Rating  *int    `json:"rating"` // Use pointers to differentiate between no update and zero value
-		Content *string `json:"content"`
-	}
-
-	err = a.readJSON(w, r, &input)
+	product, err := a.productModel.Get(productID)
 	if err != nil {
-		a.badRequestResponse(w, r, err)
+		a.serverErrorResponse(w, r, err)
 		return
 	}
 
-	// We need to now check the fields to see which ones need updating
-	if input.Rating != nil {
-		review.Rating = *input.Rating
-	}
-	if input.Content != nil {
-		review.Content = *input.Content
+	// A PATCH body is either a plain JSON object holding only the fields
+	// to change, or a merge patch / JSON patch applied to the review
+	switch a.requestMediaType(r) {
+	case "application/json":
+		var input struct {
+			Rating  *int    `json:"rating"` // Use pointers to differentiate between no update and zero value
+			Content *string `json:"content"`
+		}
+
+		err = a.readJSON(w, r, &input)
+		if err != nil {
+			a.badRequestResponse(w, r, err)
+			return
+		}
+
+		// We need to now check the fields to see which ones need updating
+		if input.Rating != nil {
+			review.Rating = *input.Rating
+		}
+		if input.Content != nil {
+			review.Content = *input.Content
+		}
+	case mergePatchMediaType, jsonPatchMediaType:
+		input := reviewInput{
+			Rating:  review.Rating,
+			Content: review.Content,
+		}
+
+		err = a.readPatch(w, r, &input)
+		if err != nil {
+			switch {
+			case errors.Is(err, errPatchTestFailed):
+				a.conflictResponse(w, r, err)
+			default:
+				a.badRequestResponse(w, r, err)
+			}
+			return
+		}
+
+		review.Rating = input.Rating
+		review.Content = input.Content
+	default:
+		a.unsupportedMediaTypeResponse(w, r)
+		return
 	}
 	// Before we write the updates to the DB let's validate
 	v := validator.New()
@@ -150,10 +221,20 @@ func (a *applicationDependencies) updateReviewHandler(w http.ResponseWriter, r *
 		a.failedValidationResponse(w, r, v.Errors)
 		return
 	}
+	a.requeueEditedReview(original, review, product)
+	if review.Content != original.Content && !a.screenReview(w, r, review) {
+		return
+	}
+	a.scoreSentiment(review)
 	// Save the updated product in the database
 	err = a.reviewModel.Update(review)
 	if err != nil {
-		a.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			a.editConflictResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 	//update now update the average rating for the product
@@ -164,13 +245,98 @@ func (a *applicationDependencies) updateReviewHandler(w http.ResponseWriter, r *
 	}
 	//Send a JSON response with the updated product
 	data := envelope{"review": review}
-	err = a.writeJSON(w, http.StatusOK, data, nil)
+	err = a.writeJSON(w, r, http.StatusOK, data, nil)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 	}
 
 }
 
+// replaceReviewHandler replaces every editable field of a review, so
+// fields missing from the body are cleared rather than left unchanged
+func (a *applicationDependencies) replaceReviewHandler(w http.ResponseWriter, r *http.Request) {
+	productID, err := a.readIDParam(r, "prod_id")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	reviewID, err := a.readIDParam(r, "review_id")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	review, err := a.reviewModel.Get(productID, reviewID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	original := *review
+
+	product, err := a.productModel.Get(productID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if a.requestMediaType(r) != "application/json" {
+		a.unsupportedMediaTypeResponse(w, r)
+		return
+	}
+
+	var input reviewInput
+	err = a.readJSON(w, r, &input)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	review.Rating = input.Rating
+	review.Content = input.Content
+
+	v := validator.New()
+	data.ValidateReview(v, review)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	a.requeueEditedReview(original, review, product)
+	if review.Content != original.Content && !a.screenReview(w, r, review) {
+		return
+	}
+	a.scoreSentiment(review)
+
+	err = a.reviewModel.Update(review)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			a.editConflictResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// the rating may have changed
+	err = a.productModel.UpdateAverageRating(productID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{"review": review}
+	err = a.writeJSON(w, r, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
 func (a *applicationDependencies) deleteReviewHandler(w http.ResponseWriter, r *http.Request) {
 
 	productID, err := a.readIDParam(r, "prod_id")
@@ -185,6 +351,14 @@ func (a *applicationDependencies) deleteReviewHandler(w http.ResponseWriter, r *
 		return
 	}
 
+	// the photos go with the review, their files are removed once it is
+	// deleted
+	reviewMedia, err := a.mediaModel.GetForReview(reviewID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
 	err = a.reviewModel.Delete(productID, reviewID)
 
 	if err != nil {
@@ -197,6 +371,8 @@ func (a *applicationDependencies) deleteReviewHandler(w http.ResponseWriter, r *
 		return
 	}
 
+	a.deleteBlobs(data.MediaKeys(reviewMedia...)...)
+
 	// Update the product's average rating
 	err = a.productModel.UpdateAverageRating(productID)
 	if err != nil {
@@ -208,7 +384,7 @@ func (a *applicationDependencies) deleteReviewHandler(w http.ResponseWriter, r *
 	data := envelope{
 		"message": "review successfully deleted",
 	}
-	err = a.writeJSON(w, http.StatusOK, data, nil)
+	err = a.writeJSON(w, r, http.StatusOK, data, nil)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 	}
@@ -217,24 +393,38 @@ func (a *applicationDependencies) deleteReviewHandler(w http.ResponseWriter, r *
 func (a *applicationDependencies) listReviewHandler(w http.ResponseWriter, r *http.Request) {
 
 	var queryParametersData struct {
-		Rating  int
-		Content string
+		data.ReviewQuery
+		IDs []int64
 		data.Filters
 	}
 
 	// Step 2: Parse query parameters
+	v := validator.New()
 	query := r.URL.Query()
-	queryParametersData.Rating = a.getSingleIntegerParameter(query, "rating", 0, nil) // default 0 = no filter
+	queryParametersData.Ratings = a.getMultipleIntegerParameters(query, "rating", nil, v) // nil = no filter
 	queryParametersData.Content = a.getSingleQueryParameter(query, "content", "")
+	queryParametersData.HasMedia = a.getOptionalBoolParameter(query, "has_media", v)
+	queryParametersData.Verified = a.getOptionalBoolParameter(query, "verified", v)
+	queryParametersData.Sentiments = a.getMultipleQueryParameters(query, "sentiment", nil)
+	queryParametersData.Mismatch = a.getOptionalBoolParameter(query, "sentiment_mismatch", v)
+	queryParametersData.IDs = a.getMultipleIntegerParameters(query, "ids", nil, v)
+
+	// a batch lookup by ids ignores the other filters and pagination
+	if queryParametersData.IDs != nil {
+		a.batchReviewsResponse(w, r, queryParametersData.IDs, v)
+		return
+	}
 
 	// Pagination and sorting
-	v := validator.New()
 	queryParametersData.Filters.Page = a.getSingleIntegerParameter(query, "page", 1, v)
 	queryParametersData.Filters.PageSize = a.getSingleIntegerParameter(query, "page_size", 10, v)
 	queryParametersData.Filters.Sort = a.getSingleQueryParameter(query, "sort", "id")
-	queryParametersData.Filters.SortSafeList = []string{"id", "rating", "helpful_count", "-id", "-rating", "-helpful_count"}
+	queryParametersData.Filters.SortSafeList = []string{"id", "rating", "helpful_count", "verified_purchase", "sentiment_score", "-id", "-rating", "-helpful_count", "-verified_purchase", "-sentiment_score"}
+	queryParametersData.Filters.SortNullable = []string{"sentiment_score"}
 
 	//  Validate filters
+	data.ValidateRatings(v, "rating", queryParametersData.Ratings)
+	data.ValidateSentiments(v, "sentiment", queryParametersData.Sentiments)
 	data.ValidateFilters(v, queryParametersData.Filters)
 	if !v.IsEmpty() {
 		a.failedValidationResponse(w, r, v.Errors)
@@ -242,18 +432,20 @@ func (a *applicationDependencies) listReviewHandler(w http.ResponseWriter, r *ht
 	}
 
 	// Retrieve reviews from the database
-	reviews, metadata, err := a.reviewModel.GetAll(queryParametersData.Rating, queryParametersData.Content, queryParametersData.Filters)
+	reviews, metadata, err := a.reviewModel.GetAll(queryParametersData.ReviewQuery, queryParametersData.Filters)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 		return
 	}
 
 	// Send the JSON response with reviews and pagination metadata
+	links, headers := a.paginate(r, metadata)
 	responseData := envelope{
 		"reviews":   reviews,
 		"@metadata": metadata,
+		"links":     links,
 	}
-	err = a.writeJSON(w, http.StatusOK, responseData, nil)
+	err = a.writeJSON(w, r, http.StatusOK, responseData, headers)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 	}
@@ -270,24 +462,30 @@ func (a *applicationDependencies) listReviewsForProductHandler(w http.ResponseWr
 
 	//  Set up query parameter struct
 	var queryParametersData struct {
-		Rating  int
-		Content string
+		data.ReviewQuery
 		data.Filters
 	}
 
 	// Parse query parameters
+	v := validator.New()
 	query := r.URL.Query()
-	queryParametersData.Rating = a.getSingleIntegerParameter(query, "rating", 0, nil)
+	queryParametersData.Ratings = a.getMultipleIntegerParameters(query, "rating", nil, v)
 	queryParametersData.Content = a.getSingleQueryParameter(query, "content", "")
+	queryParametersData.HasMedia = a.getOptionalBoolParameter(query, "has_media", v)
+	queryParametersData.Verified = a.getOptionalBoolParameter(query, "verified", v)
+	queryParametersData.Sentiments = a.getMultipleQueryParameters(query, "sentiment", nil)
+	queryParametersData.Mismatch = a.getOptionalBoolParameter(query, "sentiment_mismatch", v)
 
 	// Pagination and sorting
-	v := validator.New()
 	queryParametersData.Filters.Page = a.getSingleIntegerParameter(query, "page", 1, v)
 	queryParametersData.Filters.PageSize = a.getSingleIntegerParameter(query, "page_size", 10, v)
 	queryParametersData.Filters.Sort = a.getSingleQueryParameter(query, "sort", "id")
-	queryParametersData.Filters.SortSafeList = []string{"id", "rating", "helpful_count", "-id", "-rating", "-helpful_count"}
+	queryParametersData.Filters.SortSafeList = []string{"id", "rating", "helpful_count", "verified_purchase", "sentiment_score", "-id", "-rating", "-helpful_count", "-verified_purchase", "-sentiment_score"}
+	queryParametersData.Filters.SortNullable = []string{"sentiment_score"}
 
 	// Validate filters
+	data.ValidateRatings(v, "rating", queryParametersData.Ratings)
+	data.ValidateSentiments(v, "sentiment", queryParametersData.Sentiments)
 	data.ValidateFilters(v, queryParametersData.Filters)
 	if !v.IsEmpty() {
 		a.failedValidationResponse(w, r, v.Errors)
@@ -295,18 +493,46 @@ func (a *applicationDependencies) listReviewsForProductHandler(w http.ResponseWr
 	}
 
 	// Retrieve reviews from the database
-	reviews, metadata, err := a.reviewModel.GetAllForProduct(productID, queryParametersData.Rating, queryParametersData.Content, queryParametersData.Filters)
+	reviews, metadata, err := a.reviewModel.GetAllForProduct(productID, queryParametersData.ReviewQuery, queryParametersData.Filters)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 		return
 	}
 
 	//  Send the JSON response
+	links, headers := a.paginate(r, metadata)
 	responseData := envelope{
 		"reviews":   reviews,
 		"@metadata": metadata,
+		"links":     links,
+	}
+	err = a.writeJSON(w, r, http.StatusOK, responseData, headers)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// batchReviewsResponse sends the reviews with the given ids in the
+// order they were requested and lists the ids that were not found
+func (a *applicationDependencies) batchReviewsResponse(w http.ResponseWriter, r *http.Request, ids []int64, v *validator.Validator) {
+
+	data.ValidateIDs(v, "ids", ids)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	reviews, missing, err := a.reviewModel.GetByIDs(ids)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"reviews":     reviews,
+		"missing_ids": missing,
 	}
-	err = a.writeJSON(w, http.StatusOK, responseData, nil)
+	err = a.writeJSON(w, r, http.StatusOK, data, nil)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 	}
@@ -347,7 +573,7 @@ func (a *applicationDependencies) markReviewHelpfulHandler(w http.ResponseWriter
 
 	// Send a JSON response with the updated review
 	data := envelope{"review": review}
-	err = a.writeJSON(w, http.StatusOK, data, nil)
+	err = a.writeJSON(w, r, http.StatusOK, data, nil)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 	}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/georgie5/productReview/internal/data"
+)
+
+// publishedRevision is what readers see of an earlier version of a
+// review. The content is only shown when the version was published as it
+// stood, a version held or rejected by a moderator stays hidden.
+type publishedRevision struct {
+	Revision   int       `json:"revision"`
+	Rating     int       `json:"rating"`
+	Content    string    `json:"content,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	ReplacedAt time.Time `json:"replaced_at"`
+}
+
+// publishedRevisions returns the revisions as readers see them
+func publishedRevisions(revisions []*data.ReviewRevision) []publishedRevision {
+	published := make([]publishedRevision, 0, len(revisions))
+	for _, revision := range revisions {
+		p := publishedRevision{
+			Revision:   revision.Revision,
+			Rating:     revision.Rating,
+			CreatedAt:  revision.CreatedAt,
+			ReplacedAt: revision.ReplacedAt,
+		}
+		if revision.Published() {
+			p.Content = revision.Content
+		}
+		published = append(published, p)
+	}
+	return published
+}
+
+// listReviewRevisionsHandler lists the earlier versions of a published
+// review, oldest first, so readers can see how it changed. The full
+// history is only shown to moderators by reviewHistoryHandler.
+func (a *applicationDependencies) listReviewRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	review, ok := a.readPublishedReview(w, r)
+	if !ok {
+		return
+	}
+
+	revisions, err := a.revisionModel.GetForReview(review.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"revisions":      publishedRevisions(revisions),
+		"revision_count": review.RevisionCount,
+		"edited_at":      review.EditedAt,
+	}
+	err = a.writeJSON(w, r, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// reviewHistoryHandler shows moderators every version of a review, with
+// whatever its status, and what each edit changed
+func (a *applicationDependencies) reviewHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	reviewID, err := a.readIDParam(r, "review_id")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	review, err := a.reviewModel.GetByID(reviewID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	revisions, err := a.revisionModel.GetForReview(review.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"review":  screenedReview{review, review.ScreeningVerdict, review.ScreeningReasons},
+		"history": data.History(review, revisions),
+	}
+	err = a.writeJSON(w, r, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/georgie5/productReview/internal/data"
+)
+
+func TestPublishedRevisions(t *testing.T) {
+	revisions := []*data.ReviewRevision{
+		{Revision: 1, Rating: 5, Content: "Great", Status: data.ReviewStatusApproved},
+		{Revision: 2, Rating: 1, Content: "Insults", Status: data.ReviewStatusRejected},
+		{Revision: 3, Rating: 2, Content: "Waiting", Status: data.ReviewStatusPending},
+		{Revision: 4, Rating: 3, Content: "Reported", Status: data.ReviewStatusHidden},
+		{Revision: 5, Rating: 4, Content: "Before statuses were kept"},
+	}
+
+	published := publishedRevisions(revisions)
+	if len(published) != len(revisions) {
+		t.Fatalf("got %d revisions, want %d", len(published), len(revisions))
+	}
+
+	for i, revision := range revisions {
+		got := published[i]
+		if got.Revision != revision.Revision || got.Rating != revision.Rating {
+			t.Errorf("revision %d: got revision %d rated %d", revision.Revision, got.Revision, got.Rating)
+		}
+
+		// only the content readers could see at the time is shown
+		want := ""
+		if revision.Status == data.ReviewStatusApproved {
+			want = revision.Content
+		}
+		if got.Content != want {
+			t.Errorf("revision %d (%q): content = %q, want %q", revision.Revision, revision.Status, got.Content, want)
+		}
+	}
+}
@@ -14,25 +14,85 @@ func (a *applicationDependencies) routes() http.Handler {
 	router.NotFound = http.HandlerFunc(a.notFoundResponse)
 	// handle 405
 	router.MethodNotAllowed = http.HandlerFunc(a.methodNotAllowedResponse)
+	// handle OPTIONS (CORS preflight) for every path
+	router.GlobalOPTIONS = http.HandlerFunc(a.preflightHandler)
 	// setup product routes
-	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", a.healthcheckHandler)
-	router.HandlerFunc(http.MethodPost, "/v1/products", a.createProductHandler)            //create product
-	router.HandlerFunc(http.MethodGet, "/v1/products/:prod_id", a.displayProductHandler)   //display specific product
-	router.HandlerFunc(http.MethodPatch, "/v1/products/:prod_id", a.updateProductHandler)  //update specific product
-	router.HandlerFunc(http.MethodDelete, "/v1/products/:prod_id", a.deleteProductHandler) //delete specific product
-	router.HandlerFunc(http.MethodGet, "/v1/products", a.listProductHandler)               // get all/sorting/filtering/products
+	a.handle(router, http.MethodGet, "/v1/healthcheck", a.healthcheckHandler)
+	a.handle(router, http.MethodGet, "/v1/healthcheck/live", a.livenessHandler)
+	a.handle(router, http.MethodGet, "/v1/healthcheck/ready", a.readinessHandler)
+	a.handle(router, http.MethodPost, "/v1/products", a.createProductHandler)            //create product
+	a.handle(router, http.MethodGet, "/v1/products/:prod_id", a.displayProductHandler)   //display specific product
+	a.handle(router, http.MethodPatch, "/v1/products/:prod_id", a.updateProductHandler)  //update specific product
+	a.handle(router, http.MethodPut, "/v1/products/:prod_id", a.replaceProductHandler)   //replace specific product
+	a.handle(router, http.MethodDelete, "/v1/products/:prod_id", a.deleteProductHandler) //delete specific product
+	a.handle(router, http.MethodGet, "/v1/products", a.listProductHandler)               // get all/sorting/filtering/products
+
+	// uploaded product images, with resized variants
+	a.handle(router, http.MethodGet, "/v1/products/:prod_id/images", a.listProductImagesHandler)
+	a.handle(router, http.MethodPost, "/v1/products/:prod_id/images", a.uploadProductImagesHandler)
+	a.handle(router, http.MethodPatch, "/v1/products/:prod_id/images/:image_id", a.updateProductImageHandler)
+	a.handle(router, http.MethodDelete, "/v1/products/:prod_id/images/:image_id", a.deleteProductImageHandler)
 
 	//setup review routes
-	router.HandlerFunc(http.MethodPost, "/v1/products/:prod_id/reviews", a.createReviewHandler)
-	router.HandlerFunc(http.MethodGet, "/v1/products/:prod_id/reviews/:review_id", a.displayReviewHandler)
-	router.HandlerFunc(http.MethodPatch, "/v1/products/:prod_id/reviews/:review_id", a.updateReviewHandler)
-	router.HandlerFunc(http.MethodDelete, "/v1/products/:prod_id/reviews/:review_id", a.deleteReviewHandler)
-	router.HandlerFunc(http.MethodGet, "/v1/reviews", a.listReviewHandler)                                              // list of all reviews
-	router.HandlerFunc(http.MethodGet, "/v1/products/:prod_id/reviews", a.listReviewsForProductHandler)                 //list of all reviews for specific product
-	router.HandlerFunc(http.MethodPost, "/v1/products/:prod_id/reviews/:review_id/helpful", a.markReviewHelpfulHandler) //helpful count for products that were helpful
-
-	// Request sent first to recoverPanic() then sent to rateLimit()
+	// creating reviews has a stricter limit than the global one
+	reviewLimit := rateLimitPolicy{name: "review-create", rps: a.config.limiter.reviewRPS, burst: a.config.limiter.reviewBurst}
+	a.handle(router, http.MethodPost, "/v1/products/:prod_id/reviews", a.rateLimitWith(reviewLimit, http.HandlerFunc(a.createReviewHandler)).ServeHTTP)
+	a.handle(router, http.MethodGet, "/v1/products/:prod_id/reviews/:review_id", a.displayReviewHandler)
+	a.handle(router, http.MethodPatch, "/v1/products/:prod_id/reviews/:review_id", a.updateReviewHandler)
+	a.handle(router, http.MethodPut, "/v1/products/:prod_id/reviews/:review_id", a.replaceReviewHandler)
+	a.handle(router, http.MethodDelete, "/v1/products/:prod_id/reviews/:review_id", a.deleteReviewHandler)
+	a.handle(router, http.MethodGet, "/v1/reviews", a.listReviewHandler)                                                 // list of all reviews
+	a.handle(router, http.MethodGet, "/v1/products/:prod_id/sentiment", a.productSentimentHandler)                       // sentiment breakdown of the reviews
+	a.handle(router, http.MethodGet, "/v1/products/:prod_id/reviews", a.listReviewsForProductHandler)                    //list of all reviews for specific product
+	a.handle(router, http.MethodPost, "/v1/products/:prod_id/reviews/:review_id/helpful", a.markReviewHelpfulHandler)    //helpful count for products that were helpful
+	a.handle(router, http.MethodPost, "/v1/products/:prod_id/reviews/:review_id/reports", a.createReportHandler)         // report an abusive review
+	a.handle(router, http.MethodGet, "/v1/products/:prod_id/reviews/:review_id/revisions", a.listReviewRevisionsHandler) // earlier versions of an edited review
+
+	// photos attached to reviews
+	a.handle(router, http.MethodPost, "/v1/products/:prod_id/reviews/:review_id/media", a.uploadReviewMediaHandler)
+	a.handle(router, http.MethodGet, "/v1/media/*key", a.serveMediaHandler)
+
+	// comment threads on published reviews
+	a.handle(router, http.MethodGet, "/v1/products/:prod_id/reviews/:review_id/comments", a.listCommentsHandler)
+	a.handle(router, http.MethodPost, "/v1/products/:prod_id/reviews/:review_id/comments", a.createCommentHandler)
+	a.handle(router, http.MethodGet, "/v1/products/:prod_id/reviews/:review_id/comments/:comment_id", a.displayCommentHandler)
+	a.handle(router, http.MethodPatch, "/v1/products/:prod_id/reviews/:review_id/comments/:comment_id", a.updateCommentHandler)
+	a.handle(router, http.MethodDelete, "/v1/products/:prod_id/reviews/:review_id/comments/:comment_id", a.deleteCommentHandler)
+
+	// the official merchant response, shown with the review
+	a.handle(router, http.MethodGet, "/v1/products/:prod_id/reviews/:review_id/response", a.displayResponseHandler)
+	a.handle(router, http.MethodPost, "/v1/products/:prod_id/reviews/:review_id/response", a.requireAdmin(a.createResponseHandler))
+	a.handle(router, http.MethodPatch, "/v1/products/:prod_id/reviews/:review_id/response", a.requireAdmin(a.updateResponseHandler))
+	a.handle(router, http.MethodDelete, "/v1/products/:prod_id/reviews/:review_id/response", a.requireAdmin(a.deleteResponseHandler))
+
+	// orders imported from the order system, which verify reviews
+	a.handle(router, http.MethodPost, "/v1/purchases", a.requireAdmin(a.importPurchasesHandler))
+
+	// moderation, only for the holder of the admin token
+	a.handle(router, http.MethodGet, "/v1/moderation/reviews", a.requireAdmin(a.listModerationQueueHandler))
+	a.handle(router, http.MethodPost, "/v1/moderation/reviews/:review_id/approve", a.requireAdmin(a.approveReviewHandler))
+	a.handle(router, http.MethodPost, "/v1/moderation/reviews/:review_id/reject", a.requireAdmin(a.rejectReviewHandler))
+	a.handle(router, http.MethodGet, "/v1/moderation/reviews/:review_id/history", a.requireAdmin(a.reviewHistoryHandler))
+	a.handle(router, http.MethodGet, "/v1/moderation/reports", a.requireAdmin(a.listReportsHandler))
+	a.handle(router, http.MethodGet, "/v1/moderation/comments", a.requireAdmin(a.listCommentQueueHandler))
+	a.handle(router, http.MethodPost, "/v1/moderation/comments/:comment_id/approve", a.requireAdmin(a.approveCommentHandler))
+	a.handle(router, http.MethodPost, "/v1/moderation/comments/:comment_id/reject", a.requireAdmin(a.rejectCommentHandler))
+
+	// metrics
+	a.handle(router, http.MethodGet, "/debug/metrics", a.metricsHandler)
+
+	// Request sent first to requestID(), recordMetrics(), logRequest(),
+	// compress() and recoverPanic(), then sent to enableCORS() and rateLimit(),
 	// finally it is sent to the router.
-	return a.recoverPanic(a.rateLimit(router))
+	return a.requestID(a.recordMetrics(a.logRequest(a.compress(a.recoverPanic(a.enableCORS(a.rateLimit(router)))))))
+
+}
 
+// handle registers a route handler that reports its route pattern to
+// recordMetrics(), so requests are counted per route and not per URL
+func (a *applicationDependencies) handle(router *httprouter.Router, method string, pattern string, handler http.HandlerFunc) {
+	router.HandlerFunc(method, pattern, func(w http.ResponseWriter, r *http.Request) {
+		a.contextSetRoute(r, pattern)
+		handler(w, r)
+	})
 }
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/georgie5/productReview/internal/data"
+)
+
+// scoreSentiment scores the content of a review and stores the result on
+// it
+func (a *applicationDependencies) scoreSentiment(review *data.Review) {
+	result := a.sentiment.Analyze(review.Content)
+	review.SentimentScore = &result.Score
+	review.SentimentLabel = string(result.Label)
+}
+
+// productSentimentHandler breaks down the sentiment of the published
+// reviews of a product, overall and for each rating
+func (a *applicationDependencies) productSentimentHandler(w http.ResponseWriter, r *http.Request) {
+	product, ok := a.readProductParam(w, r)
+	if !ok {
+		return
+	}
+
+	breakdown, err := a.reviewModel.SentimentBreakdown(product.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = a.writeJSON(w, r, http.StatusOK, envelope{"sentiment": breakdown}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"runtime/debug"
 	"syscall"
 	"time"
 )
@@ -17,12 +18,45 @@ func (a *applicationDependencies) serve() error {
 	apiServer := &http.Server{
 		Addr:         fmt.Sprintf(":%d", a.config.port),
 		Handler:      a.routes(),
-		IdleTimeout:  time.Minute,
-		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 10 * time.Second,
+		IdleTimeout:  a.config.http.idleTimeout,
+		ReadTimeout:  a.config.http.readTimeout,
+		WriteTimeout: a.config.http.writeTimeout,
 		ErrorLog:     slog.NewLogLogger(a.logger.Handler(), slog.LevelError),
 	}
 
+	// the periodic background tasks run until the server shuts down
+	tasksCtx, stopTasks := context.WithCancel(context.Background())
+
+	// remove stale rate limiter buckets
+	a.background(func() {
+		a.cleanupRateLimiter(tasksCtx)
+	})
+
+	// serve HTTPS with a certificate that is reloaded when it changes
+	var redirectServer *http.Server
+	if a.config.tls.certFile != "" {
+		reloader, err := newCertReloader(a.config.tls.certFile, a.config.tls.keyFile)
+		if err != nil {
+			stopTasks()
+			return err
+		}
+		apiServer.TLSConfig = a.tlsConfig(reloader)
+		a.background(func() {
+			a.watchCertificate(tasksCtx, reloader)
+		})
+
+		if a.config.tls.redirectAddr != "" {
+			redirectServer = a.redirectServer()
+			go func() {
+				a.logger.Info("starting HTTPS redirect server", "address", redirectServer.Addr)
+				err := redirectServer.ListenAndServe()
+				if !errors.Is(err, http.ErrServerClosed) {
+					a.logger.Error("HTTPS redirect server failed", "error", err.Error())
+				}
+			}()
+		}
+	}
+
 	// create a channel to keep track of any errors during the shutdown process
 	shutdownError := make(chan error)
 	// create a goroutine that runs in the background listening
@@ -33,21 +67,54 @@ func (a *applicationDependencies) serve() error {
 		s := <-quit                                          // blocks until a signal is received
 		// message about shutdown in process
 		a.logger.Info("shutting down server", "signal", s.String())
+
+		// fail the readiness check so the load balancer stops sending
+		// new requests, and give it some time to notice
+		a.draining.Store(true)
+		time.Sleep(a.config.drainDelay)
+
 		// create a context
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		ctx, cancel := context.WithTimeout(context.Background(), a.config.http.shutdownTimeout)
 		defer cancel()
 
+		// stop the periodic background tasks
+		stopTasks()
+
+		if redirectServer != nil {
+			err := redirectServer.Shutdown(ctx)
+			if err != nil {
+				a.logger.Error("could not shut down HTTPS redirect server", "error", err.Error())
+			}
+		}
+
 		// initiate the shutdown. If all okay returns nil
-		shutdownError <- apiServer.Shutdown(ctx)
+		err := apiServer.Shutdown(ctx)
+
+		// handlers may have started background tasks until the last
+		// request completed, wait for them within the same deadline. When
+		// the shutdown already used it up, waitBackground logs the tasks
+		// still running.
+		a.logger.Info("completing background tasks", "running", a.backgroundRunning.Load())
+		shutdownError <- errors.Join(err, a.waitBackground(ctx))
 	}()
 
-	a.logger.Info("starting server", "address", apiServer.Addr, "environment", a.config.environment)
+	a.logger.Info("starting server", "address", apiServer.Addr, "environment", a.config.environment, "tls", apiServer.TLSConfig != nil)
 
 	// something went wrong during shutdown if we don't get ErrServerClosed()
 	// this only happens when we issue the shutdown command from our goroutine
 	// otherwise our server keeps running as normal as it should.
-	err := apiServer.ListenAndServe()
+	var err error
+	if apiServer.TLSConfig != nil {
+		// the certificate comes from TLSConfig.GetCertificate
+		err = apiServer.ListenAndServeTLS("", "")
+	} else {
+		err = apiServer.ListenAndServe()
+	}
 	if !errors.Is(err, http.ErrServerClosed) {
+		stopTasks()
+		if redirectServer != nil {
+			redirectServer.Close()
+		}
 		return err
 	}
 
@@ -62,3 +129,43 @@ func (a *applicationDependencies) serve() error {
 	return nil
 
 }
+
+// background runs fn in its own goroutine, for work that carries on after
+// the response is sent. A panic in fn is logged instead of crashing the
+// server, and serve waits for the task before it exits.
+func (a *applicationDependencies) background(fn func()) {
+	a.wg.Add(1)
+	a.backgroundRunning.Add(1)
+
+	go func() {
+		defer a.wg.Done()
+		defer a.backgroundRunning.Add(-1)
+
+		defer func() {
+			err := recover()
+			if err != nil {
+				a.logger.Error("background task panicked", "error", fmt.Sprint(err), "stack", string(debug.Stack()))
+			}
+		}()
+
+		fn()
+	}()
+}
+
+// waitBackground waits for the background tasks to finish, or until the
+// context expires
+func (a *applicationDependencies) waitBackground(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		a.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		a.logger.Error("background tasks still running at the shutdown deadline", "running", a.backgroundRunning.Load())
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWaitBackground(t *testing.T) {
+	a := &applicationDependencies{logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+
+	var finished atomic.Int32
+	for i := 0; i < 3; i++ {
+		a.background(func() {
+			time.Sleep(10 * time.Millisecond)
+			finished.Add(1)
+		})
+	}
+	// a panicking task is logged and still counts as finished
+	a.background(func() { panic("boom") })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := a.waitBackground(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if finished.Load() != 3 {
+		t.Errorf("%d tasks finished, want 3", finished.Load())
+	}
+	if running := a.backgroundRunning.Load(); running != 0 {
+		t.Errorf("%d tasks still counted as running, want 0", running)
+	}
+}
+
+func TestWaitBackgroundDeadline(t *testing.T) {
+	a := &applicationDependencies{logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+
+	release := make(chan struct{})
+	a.background(func() { <-release })
+	defer func() {
+		close(release)
+		a.wg.Wait()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := a.waitBackground(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got error %v, want %v", err, context.DeadlineExceeded)
+	}
+	if running := a.backgroundRunning.Load(); running != 1 {
+		t.Errorf("%d tasks counted as running, want 1", running)
+	}
+}
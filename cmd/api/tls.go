@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// certReloader serves the certificate loaded from the -tls-cert and
+// -tls-key files, and swaps it when the files change. Connections that
+// are already open keep the certificate they were set up with.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu          sync.Mutex // serializes reloads
+	certificate atomic.Pointer[tls.Certificate]
+	modTime     time.Time // newest modification time of the two files
+}
+
+func newCertReloader(certFile string, keyFile string) (*certReloader, error) {
+	reloader := &certReloader{certFile: certFile, keyFile: keyFile}
+	err := reloader.reload()
+	if err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+// reload reads the certificate files again. A bad pair of files is
+// reported and the current certificate is kept.
+func (c *certReloader) reload() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	modTime, err := c.filesModTime()
+	if err != nil {
+		return err
+	}
+
+	certificate, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+
+	c.certificate.Store(&certificate)
+	c.modTime = modTime
+	return nil
+}
+
+// changed reports whether either file was modified since the last reload
+func (c *certReloader) changed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	modTime, err := c.filesModTime()
+	return err == nil && modTime.After(c.modTime)
+}
+
+func (c *certReloader) filesModTime() (time.Time, error) {
+	var newest time.Time
+	for _, path := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(newest) {
+			newest = info.ModTime()
+		}
+	}
+	return newest, nil
+}
+
+// getCertificate is used as tls.Config.GetCertificate
+func (c *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return c.certificate.Load(), nil
+}
+
+// tlsConfig only allows TLS 1.2 and newer, with forward secret AEAD
+// cipher suites (TLS 1.3 suites are not configurable and all secure)
+func (a *applicationDependencies) tlsConfig(reloader *certReloader) *tls.Config {
+	return &tls.Config{
+		MinVersion:       tls.VersionTLS12,
+		CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+		},
+		GetCertificate: reloader.getCertificate,
+	}
+}
+
+// watchCertificate reloads the certificate on SIGHUP, or when the files
+// change, until the context is cancelled
+func (a *applicationDependencies) watchCertificate(ctx context.Context, reloader *certReloader) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	ticker := time.NewTicker(a.config.tls.reloadInterval)
+	defer ticker.Stop()
+
+	for {
+		reason := ""
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			reason = "SIGHUP"
+		case <-ticker.C:
+			if !reloader.changed() {
+				continue
+			}
+			reason = "files changed"
+		}
+
+		err := reloader.reload()
+		if err != nil {
+			a.logger.Error("could not reload TLS certificate, keeping the current one", "reason", reason, "error", err.Error())
+			continue
+		}
+		a.logger.Info("reloaded TLS certificate", "reason", reason, "cert", reloader.certFile)
+	}
+}
+
+// redirectServer answers plain HTTP requests with a redirect to the
+// same URL over HTTPS
+func (a *applicationDependencies) redirectServer() *http.Server {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h
+		}
+		if a.config.port != 443 {
+			host = net.JoinHostPort(host, fmt.Sprint(a.config.port))
+		}
+
+		// 308 keeps the method and body of non GET requests
+		status := http.StatusPermanentRedirect
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			status = http.StatusMovedPermanently
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), status)
+	})
+
+	return &http.Server{
+		Addr:         a.config.tls.redirectAddr,
+		Handler:      handler,
+		IdleTimeout:  a.config.http.idleTimeout,
+		ReadTimeout:  a.config.http.readTimeout,
+		WriteTimeout: a.config.http.writeTimeout,
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log/slog"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCertificate writes a self-signed certificate for localhost with
+// the given serial number, and its key, to the two files. Both files get
+// modTime as their modification time.
+func writeCertificate(t *testing.T, certFile string, keyFile string, serial int64, modTime time.Time) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// set the times explicitly, the clock of the file system may be too
+	// coarse to tell two writes apart
+	for _, path := range []string{certFile, keyFile} {
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// servedSerial returns the serial number of the certificate the reloader
+// hands out to new connections
+func servedSerial(t *testing.T, reloader *certReloader) int64 {
+	t.Helper()
+
+	certificate, err := reloader.getCertificate(&tls.ClientHelloInfo{ServerName: "localhost"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.SerialNumber.Int64()
+}
+
+func TestCertReloaderReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	start := time.Now().Add(-time.Minute)
+
+	writeCertificate(t, certFile, keyFile, 1, start)
+	reloader, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := servedSerial(t, reloader); got != 1 {
+		t.Fatalf("serving serial %d, want 1", got)
+	}
+	if reloader.changed() {
+		t.Fatal("changed() = true before the files changed")
+	}
+
+	writeCertificate(t, certFile, keyFile, 2, start.Add(time.Second))
+	if !reloader.changed() {
+		t.Fatal("changed() = false after the files changed")
+	}
+	// nothing is swapped until the reload
+	if got := servedSerial(t, reloader); got != 1 {
+		t.Fatalf("serving serial %d before the reload, want 1", got)
+	}
+
+	err = reloader.reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := servedSerial(t, reloader); got != 2 {
+		t.Fatalf("serving serial %d after the reload, want 2", got)
+	}
+	if reloader.changed() {
+		t.Fatal("changed() = true after the reload")
+	}
+
+	// a broken pair of files is reported and the current certificate kept
+	err = os.WriteFile(keyFile, []byte("not a key"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := reloader.reload(); err == nil {
+		t.Fatal("reload() of a broken key succeeded")
+	}
+	if got := servedSerial(t, reloader); got != 2 {
+		t.Fatalf("serving serial %d after a failed reload, want 2", got)
+	}
+}
+
+func TestWatchCertificateReloadsChangedFiles(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	start := time.Now().Add(-time.Minute)
+
+	writeCertificate(t, certFile, keyFile, 1, start)
+	reloader, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := &applicationDependencies{logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	a.config.tls.reloadInterval = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		a.watchCertificate(ctx, reloader)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	writeCertificate(t, certFile, keyFile, 2, start.Add(time.Second))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for servedSerial(t, reloader) != 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("the changed certificate was not reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the certificate served by a TLS listener is the reloaded one
+	config := a.tlsConfig(reloader)
+	certificate, err := config.GetCertificate(&tls.ClientHelloInfo{ServerName: "localhost"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leaf.SerialNumber.Int64() != 2 {
+		t.Fatalf("tls.Config serves serial %d, want 2", leaf.SerialNumber.Int64())
+	}
+}
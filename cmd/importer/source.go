@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/georgie5/productReview/internal/data"
+)
+
+// row is a single product or purchase read from an input file, or the
+// reason the line could not be turned into one
+type row[T any] struct {
+	line  int
+	value *T
+	err   error
+}
+
+// columnSetter sets a field of a record from the value of a CSV column
+type columnSetter[T any] func(record *T, value string) error
+
+// productColumns maps the accepted column names to the product fields
+var productColumns = map[string]columnSetter[data.Product]{
+	"name":      func(p *data.Product, value string) error { p.Name = value; return nil },
+	"category":  func(p *data.Product, value string) error { p.Category = value; return nil },
+	"image_url": func(p *data.Product, value string) error { p.ImageURL = value; return nil },
+}
+
+// purchaseColumns maps the accepted column names to the purchase fields
+var purchaseColumns = map[string]columnSetter[data.Purchase]{
+	"product_id": func(p *data.Purchase, value string) error {
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return errors.New("product_id must be an integer")
+		}
+		p.ProductID = id
+		return nil
+	},
+	"email":    func(p *data.Purchase, value string) error { p.Email = value; return nil },
+	"order_id": func(p *data.Purchase, value string) error { p.OrderID = value; return nil },
+	"purchased_at": func(p *data.Purchase, value string) (err error) {
+		p.PurchasedAt, err = parsePurchaseDate(value)
+		return err
+	},
+}
+
+// parsePurchaseDate accepts an RFC 3339 timestamp or a plain date
+func parsePurchaseDate(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, errors.New("purchased_at must be a date (2006-01-02) or an RFC 3339 timestamp")
+	}
+	return t, nil
+}
+
+// readCSV reads a CSV file whose first line is a header naming the columns
+func readCSV[T any](r io.Reader, columns map[string]columnSetter[T]) ([]row[T], error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	// rows with the wrong number of fields are rejected one by one
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("the file is empty")
+		}
+		return nil, err
+	}
+
+	setters := make([]columnSetter[T], len(header))
+	for i, column := range header {
+		column = strings.ToLower(strings.TrimSpace(column))
+		setter, ok := columns[column]
+		if !ok {
+			return nil, fmt.Errorf("unknown column %q", column)
+		}
+		setters[i] = setter
+	}
+
+	var rows []row[T]
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		var parseError *csv.ParseError
+		if errors.As(err, &parseError) {
+			rows = append(rows, row[T]{line: parseError.StartLine, err: parseError.Err})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		line, _ := reader.FieldPos(0)
+		if len(record) != len(header) {
+			rows = append(rows, row[T]{line: line, err: fmt.Errorf("expected %d fields, found %d", len(header), len(record))})
+			continue
+		}
+
+		value := new(T)
+		for i, field := range record {
+			err = setters[i](value, strings.TrimSpace(field))
+			if err != nil {
+				break
+			}
+		}
+		if err != nil {
+			rows = append(rows, row[T]{line: line, err: err})
+			continue
+		}
+		rows = append(rows, row[T]{line: line, value: value})
+	}
+
+	return rows, nil
+}
+
+// readNDJSON reads a file holding one JSON object per line, which decode
+// turns into a record
+func readNDJSON[T any](r io.Reader, decode func(text []byte) (*T, error)) ([]row[T], error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	var rows []row[T]
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+
+		value, err := decode(text)
+		if err != nil {
+			rows = append(rows, row[T]{line: line, err: err})
+			continue
+		}
+		rows = append(rows, row[T]{line: line, value: value})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return rows, nil
+}
+
+// decodeLine decodes a line of an NDJSON file, which must hold a single
+// JSON object with known fields
+func decodeLine(text []byte, dst any) error {
+	dec := json.NewDecoder(bytes.NewReader(text))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(dst)
+	if err == nil && !errors.Is(dec.Decode(&struct{}{}), io.EOF) {
+		err = errors.New("the line must only contain a single JSON value")
+	}
+	return err
+}
+
+// decodeProduct reads a product object of an NDJSON file
+func decodeProduct(text []byte) (*data.Product, error) {
+	var input struct {
+		Name     string `json:"name"`
+		Category string `json:"category"`
+		ImageURL string `json:"image_url"`
+	}
+	err := decodeLine(text, &input)
+	if err != nil {
+		return nil, err
+	}
+
+	return &data.Product{
+		Name:     strings.TrimSpace(input.Name),
+		Category: strings.TrimSpace(input.Category),
+		ImageURL: strings.TrimSpace(input.ImageURL),
+	}, nil
+}
+
+// decodePurchase reads a purchase object of an NDJSON file
+func decodePurchase(text []byte) (*data.Purchase, error) {
+	var input struct {
+		ProductID   int64  `json:"product_id"`
+		Email       string `json:"email"`
+		OrderID     string `json:"order_id"`
+		PurchasedAt string `json:"purchased_at"`
+	}
+	err := decodeLine(text, &input)
+	if err != nil {
+		return nil, err
+	}
+
+	purchasedAt, err := parsePurchaseDate(strings.TrimSpace(input.PurchasedAt))
+	if err != nil {
+		return nil, err
+	}
+	return &data.Purchase{
+		ProductID:   input.ProductID,
+		Email:       strings.TrimSpace(input.Email),
+		OrderID:     strings.TrimSpace(input.OrderID),
+		PurchasedAt: purchasedAt,
+	}, nil
+}
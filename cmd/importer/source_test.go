@@ -0,0 +1,167 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/georgie5/productReview/internal/data"
+)
+
+func TestReadCSVProducts(t *testing.T) {
+	const file = `Name, category ,image_url
+Kettle,Kitchen,
+  Toaster , Kitchen,https://example.com/toaster.jpg
+Lamp,Home
+"Desk ""XL""",Office,
+"broken,Office,
+`
+
+	rows, err := readCSV(strings.NewReader(file), productColumns)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		line    int
+		want    *data.Product
+		wantErr bool
+	}{
+		{line: 2, want: &data.Product{Name: "Kettle", Category: "Kitchen"}},
+		{line: 3, want: &data.Product{Name: "Toaster", Category: "Kitchen", ImageURL: "https://example.com/toaster.jpg"}},
+		{line: 4, wantErr: true}, // a missing field
+		{line: 5, want: &data.Product{Name: `Desk "XL"`, Category: "Office"}},
+		{line: 6, wantErr: true}, // an unterminated quote
+	}
+	if len(rows) != len(tests) {
+		t.Fatalf("got %d rows, want %d", len(rows), len(tests))
+	}
+
+	for i, tt := range tests {
+		got := rows[i]
+		if got.line != tt.line {
+			t.Errorf("row %d: line %d, want %d", i, got.line, tt.line)
+		}
+		if (got.err != nil) != tt.wantErr {
+			t.Errorf("line %d: error = %v, want error %t", tt.line, got.err, tt.wantErr)
+			continue
+		}
+		if tt.want != nil && !reflect.DeepEqual(got.value, tt.want) {
+			t.Errorf("line %d: got %+v, want %+v", tt.line, *got.value, *tt.want)
+		}
+	}
+}
+
+func TestReadCSVHeader(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+	}{
+		{"empty file", ""},
+		{"unknown column", "name,category,price\nKettle,Kitchen,10\n"},
+	}
+
+	for _, tt := range tests {
+		_, err := readCSV(strings.NewReader(tt.file), productColumns)
+		if err == nil {
+			t.Errorf("%s: readCSV succeeded, want an error", tt.name)
+		}
+	}
+}
+
+func TestReadNDJSONProducts(t *testing.T) {
+	const file = `{"name": " Kettle ", "category": "Kitchen"}
+
+{"name": "Lamp", "category": "Home", "price": 10}
+{"name": "Desk", "category": "Office"} {"name": "Chair"}
+not json
+{"name": "Toaster", "category": "Kitchen", "image_url": "https://example.com/toaster.jpg"}
+`
+
+	rows, err := readNDJSON(strings.NewReader(file), decodeProduct)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		line    int
+		want    *data.Product
+		wantErr bool
+	}{
+		{line: 1, want: &data.Product{Name: "Kettle", Category: "Kitchen"}},
+		{line: 3, wantErr: true}, // an unknown field
+		{line: 4, wantErr: true}, // two objects on a line
+		{line: 5, wantErr: true},
+		{line: 6, want: &data.Product{Name: "Toaster", Category: "Kitchen", ImageURL: "https://example.com/toaster.jpg"}},
+	}
+	if len(rows) != len(tests) {
+		t.Fatalf("got %d rows, want %d", len(rows), len(tests))
+	}
+
+	for i, tt := range tests {
+		got := rows[i]
+		if got.line != tt.line {
+			t.Errorf("row %d: line %d, want %d", i, got.line, tt.line)
+		}
+		if (got.err != nil) != tt.wantErr {
+			t.Errorf("line %d: error = %v, want error %t", tt.line, got.err, tt.wantErr)
+			continue
+		}
+		if tt.want != nil && !reflect.DeepEqual(got.value, tt.want) {
+			t.Errorf("line %d: got %+v, want %+v", tt.line, *got.value, *tt.want)
+		}
+	}
+}
+
+func TestParsePurchaseDate(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{value: "2024-05-02", want: time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)},
+		{value: "2024-05-02T10:00:00Z", want: time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC)},
+		{value: "2024-05-02T12:00:00+02:00", want: time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC)},
+		{value: "", wantErr: true},
+		{value: "02/05/2024", wantErr: true},
+		{value: "2024-13-01", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parsePurchaseDate(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parsePurchaseDate(%q) error = %v, want error %t", tt.value, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !got.Equal(tt.want) {
+			t.Errorf("parsePurchaseDate(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestReadNDJSONPurchases(t *testing.T) {
+	const file = `{"product_id": 1, "email": " ana@example.com ", "order_id": " A-1001 ", "purchased_at": "2024-05-02"}
+{"product_id": 1, "email": "ana@example.com", "order_id": "A-1002", "purchased_at": "yesterday"}
+{"product_id": "1", "email": "ana@example.com", "order_id": "A-1003", "purchased_at": "2024-05-02"}
+`
+
+	rows, err := readNDJSON(strings.NewReader(file), decodePurchase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows, want 3", len(rows))
+	}
+
+	want := &data.Purchase{ProductID: 1, Email: "ana@example.com", OrderID: "A-1001", PurchasedAt: time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)}
+	if rows[0].err != nil || !reflect.DeepEqual(rows[0].value, want) {
+		t.Errorf("line 1: got %+v, error %v, want %+v", rows[0].value, rows[0].err, want)
+	}
+	// an invalid date, and a product id that is not a number
+	for _, row := range rows[1:] {
+		if row.err == nil {
+			t.Errorf("line %d: succeeded, want an error", row.line)
+		}
+	}
+}
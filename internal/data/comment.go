@@ -0,0 +1,284 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/georgie5/productReview/internal/validator"
+	"github.com/lib/pq"
+)
+
+// CommentModel wraps the database connection pool
+type CommentModel struct {
+	DB *sql.DB
+}
+
+// Comment is a shopper's question or remark on a review, or a reply to
+// another comment. Comments go through the same moderation statuses as
+// reviews.
+type Comment struct {
+	ID              int64      `json:"id"`
+	ReviewID        int64      `json:"review_id"`
+	ParentID        *int64     `json:"parent_id"` // null for a comment on the review itself
+	Depth           int        `json:"depth"`     // 0 for a comment on the review itself
+	Content         string     `json:"content"`
+	Status          string     `json:"status"`
+	RejectionReason string     `json:"rejection_reason,omitempty"`
+	ModeratedAt     *time.Time `json:"moderated_at,omitempty"`
+
+	// only shown to moderators, like the screening of reviews
+	ScreeningVerdict string   `json:"-"`
+	ScreeningReasons []string `json:"-"`
+
+	CreatedAt time.Time `json:"created_at"`
+	Version   int32     `json:"version"`
+}
+
+// commentColumns is the column list of every comment query, in the order
+// scanComment reads them
+const commentColumns = `id, review_id, parent_id, depth, content, status, rejection_reason, moderated_at,
+	screening_verdict, screening_reasons, created_at, version`
+
+func scanComment(row rowScanner, comment *Comment, leading ...any) error {
+	dest := append(leading,
+		&comment.ID,
+		&comment.ReviewID,
+		&comment.ParentID,
+		&comment.Depth,
+		&comment.Content,
+		&comment.Status,
+		&comment.RejectionReason,
+		&comment.ModeratedAt,
+		&comment.ScreeningVerdict,
+		pq.Array(&comment.ScreeningReasons),
+		&comment.CreatedAt,
+		&comment.Version,
+	)
+	return row.Scan(dest...)
+}
+
+func ValidateComment(v *validator.Validator, comment *Comment) {
+	v.Check(comment.Content != "", "content", "must be provided")
+	v.Check(len(comment.Content) <= 1000, "content", "must not be more than 1000 characters long")
+}
+
+// ValidateReply checks that a reply goes under a published comment of the
+// same review, without nesting deeper than maxDepth
+func ValidateReply(v *validator.Validator, comment *Comment, parent *Comment, maxDepth int) {
+	v.Check(parent.ReviewID == comment.ReviewID, "parent_id", "must be a comment on the same review")
+	v.Check(parent.Status == ReviewStatusApproved, "parent_id", "must be a published comment")
+	v.Check(parent.Depth+1 <= maxDepth, "parent_id", fmt.Sprintf("replies must not be nested more than %d levels deep", maxDepth))
+}
+
+func (m CommentModel) Insert(comment *Comment) error {
+	query := `
+		INSERT INTO review_comments (review_id, parent_id, depth, content, status, screening_verdict, screening_reasons)
+		VALUES ($1, $2, $3, $4, $5, $6, COALESCE($7::text[], '{}'))
+		RETURNING id, created_at, version
+	`
+	args := []any{comment.ReviewID, comment.ParentID, comment.Depth, comment.Content, comment.Status,
+		comment.ScreeningVerdict, pq.Array(comment.ScreeningReasons)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&comment.ID, &comment.CreatedAt, &comment.Version)
+}
+
+// Get returns a comment of a review, whatever its status
+func (m CommentModel) Get(reviewID, commentID int64) (*Comment, error) {
+	if reviewID < 1 || commentID < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT ` + commentColumns + `
+		FROM review_comments
+		WHERE review_id = $1 AND id = $2
+	`
+
+	var comment Comment
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := scanComment(m.DB.QueryRowContext(ctx, query, reviewID, commentID), &comment)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return &comment, nil
+}
+
+// GetByID fetches a comment whatever its review and status, for the
+// moderators and for checking the parent of a reply
+func (m CommentModel) GetByID(commentID int64) (*Comment, error) {
+	if commentID < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT ` + commentColumns + `
+		FROM review_comments
+		WHERE id = $1
+	`
+
+	var comment Comment
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := scanComment(m.DB.QueryRowContext(ctx, query, commentID), &comment)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return &comment, nil
+}
+
+func (m CommentModel) Update(comment *Comment) error {
+	query := `
+		UPDATE review_comments
+		SET content = $1, status = $2, rejection_reason = $3,
+			screening_verdict = $4, screening_reasons = COALESCE($5::text[], '{}'), version = version + 1
+		WHERE id = $6 AND review_id = $7 AND version = $8
+		RETURNING version
+	`
+	args := []any{comment.Content, comment.Status, comment.RejectionReason,
+		comment.ScreeningVerdict, pq.Array(comment.ScreeningReasons), comment.ID, comment.ReviewID, comment.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&comment.Version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrEditConflict
+	}
+	return err
+}
+
+// Moderate records the decision of a moderator
+func (m CommentModel) Moderate(comment *Comment) error {
+	query := `
+		UPDATE review_comments
+		SET status = $1, rejection_reason = $2, moderated_at = NOW(), version = version + 1
+		WHERE id = $3
+		RETURNING moderated_at, version
+	`
+	args := []any{comment.Status, comment.RejectionReason, comment.ID}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&comment.ModeratedAt, &comment.Version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrRecordNotFound
+	}
+	return err
+}
+
+// Delete removes a comment along with the replies under it
+func (m CommentModel) Delete(reviewID, commentID int64) error {
+	if reviewID < 1 || commentID < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM review_comments
+		WHERE review_id = $1 AND id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, reviewID, commentID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetAllForReview returns a page of the published comments of a review. A
+// nil parentID returns every comment of the thread, otherwise only the
+// direct replies to that comment.
+func (m CommentModel) GetAllForReview(reviewID int64, parentID *int64, filters Filters) ([]*Comment, Metadata, error) {
+
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), %s
+		FROM review_comments
+		WHERE review_id = $1
+		AND status = 'approved'
+		AND ($2::bigint IS NULL OR parent_id = $2)
+		ORDER BY %s
+		LIMIT $3 OFFSET $4`, commentColumns, filters.orderBy())
+
+	return m.getPage(query, filters, reviewID, parentID, filters.limit(), filters.offset())
+}
+
+// GetAllByStatus returns a page of the comments with the given status,
+// the moderation queue when the status is pending
+func (m CommentModel) GetAllByStatus(status string, filters Filters) ([]*Comment, Metadata, error) {
+
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), %s
+		FROM review_comments
+		WHERE status = $1
+		ORDER BY %s
+		LIMIT $2 OFFSET $3`, commentColumns, filters.orderBy())
+
+	return m.getPage(query, filters, status, filters.limit(), filters.offset())
+}
+
+// getPage runs a query selecting the total count and the commentColumns
+func (m CommentModel) getPage(query string, filters Filters, args ...any) ([]*Comment, Metadata, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	comments := []*Comment{}
+	totalRecords := 0
+
+	for rows.Next() {
+		var comment Comment
+		err := scanComment(rows, &comment, &totalRecords)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		comments = append(comments, &comment)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	totalRecords, err = pageTotal(ctx, m.DB, totalRecords, filters, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
+	return comments, metadata, nil
+}
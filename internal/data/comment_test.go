@@ -0,0 +1,60 @@
+package data
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/georgie5/productReview/internal/validator"
+)
+
+func TestValidateComment(t *testing.T) {
+	tests := []struct {
+		content string
+		valid   bool
+	}{
+		{"Does it fit a 1.5 l bottle?", true},
+		{"", false},
+		{strings.Repeat("a", 1000), true},
+		{strings.Repeat("a", 1001), false},
+	}
+
+	for _, tt := range tests {
+		v := validator.New()
+		ValidateComment(v, &Comment{Content: tt.content})
+		if v.IsEmpty() != tt.valid {
+			t.Errorf("ValidateComment(%.20q) errors = %v, want valid %t", tt.content, v.Errors, tt.valid)
+		}
+	}
+}
+
+func TestValidateReply(t *testing.T) {
+	const maxDepth = 2
+
+	tests := []struct {
+		name    string
+		parent  Comment
+		message string // the error for parent_id, none when empty
+	}{
+		{name: "reply to a comment", parent: Comment{ReviewID: 1, Depth: 0, Status: ReviewStatusApproved}},
+		{name: "reply at the deepest level", parent: Comment{ReviewID: 1, Depth: 1, Status: ReviewStatusApproved}},
+		{name: "too deep", parent: Comment{ReviewID: 1, Depth: 2, Status: ReviewStatusApproved}, message: "replies must not be nested more than 2 levels deep"},
+		{name: "another review", parent: Comment{ReviewID: 2, Status: ReviewStatusApproved}, message: "must be a comment on the same review"},
+		{name: "pending parent", parent: Comment{ReviewID: 1, Status: ReviewStatusPending}, message: "must be a published comment"},
+		{name: "hidden parent", parent: Comment{ReviewID: 1, Status: ReviewStatusHidden}, message: "must be a published comment"},
+	}
+
+	for _, tt := range tests {
+		v := validator.New()
+		ValidateReply(v, &Comment{ReviewID: 1, Content: "Yes"}, &tt.parent, maxDepth)
+		if got := v.Errors["parent_id"]; got != tt.message {
+			t.Errorf("%s: parent_id error = %q, want %q", tt.name, got, tt.message)
+		}
+	}
+
+	// with no nesting allowed, no comment can be replied to
+	v := validator.New()
+	ValidateReply(v, &Comment{ReviewID: 1}, &Comment{ReviewID: 1, Status: ReviewStatusApproved}, 0)
+	if v.IsEmpty() {
+		t.Error("ValidateReply with a maximum depth of 0 succeeded, want an error")
+	}
+}
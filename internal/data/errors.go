@@ -2,6 +2,27 @@ package data
 
 import (
 	"errors"
+
+	"github.com/lib/pq"
 )
 
 var ErrRecordNotFound = errors.New("record not found")
+
+// ErrEditConflict is returned when a record changed since it was read,
+// so an update based on what was read would overwrite that change
+var ErrEditConflict = errors.New("edit conflict")
+
+// ErrLimitReached is returned when a record cannot be added because its
+// parent already has as many as allowed
+var ErrLimitReached = errors.New("limit reached")
+
+// ErrDuplicateRecord is returned when a record that must be unique
+// already exists
+var ErrDuplicateRecord = errors.New("duplicate record")
+
+// isUniqueViolation tells whether an error is PostgreSQL refusing a row
+// that breaks a unique constraint
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
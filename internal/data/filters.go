@@ -1,6 +1,10 @@
 package data
 
 import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
 	"strings"
 
 	"github.com/georgie5/productReview/internal/validator"
@@ -9,12 +13,16 @@ import (
 // The Filters type will contain the fields related to pagination
 // and eventually the fields related to sorting.
 type Filters struct {
-	Page         int // which page number does the client want
-	PageSize     int // how records per page
-	Sort         string
+	Page         int      // which page number does the client want
+	PageSize     int      // how records per page
+	Sort         string   // comma-separated sort keys, e.g. "category,-name"
 	SortSafeList []string // allowed sort fields
+	SortNullable []string // sort fields that can be NULL, which come last either way
 }
 
+// The maximum number of keys a client can sort by at once
+const maxSortKeys = 3
+
 // Next we validate page and PageSize
 // We follow the same approach that we used to validate a Comment
 func ValidateFilters(v *validator.Validator, f Filters) {
@@ -23,9 +31,28 @@ func ValidateFilters(v *validator.Validator, f Filters) {
 	v.Check(f.PageSize > 0, "page_size", "must be greater than zero")
 	v.Check(f.PageSize <= 100, "page_size", "must be a maximum of 100")
 
-	// Check if sort fields provided are valid
-	// We will implement PermittedValue() later
-	v.Check(validator.PermittedValue(f.Sort, f.SortSafeList...), "sort", "invalid sort value")
+	// Check if sort fields provided are valid, and that no column is
+	// used twice (for example "name,-name")
+	keys := f.sortKeys()
+	v.Check(len(keys) <= maxSortKeys, "sort", fmt.Sprintf("must not contain more than %d sort keys", maxSortKeys))
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		v.Check(validator.PermittedValue(key, f.SortSafeList...), "sort", "invalid sort value")
+		v.Check(!seen[sortColumn(key)], "sort", "must not sort by the same column twice")
+		seen[sortColumn(key)] = true
+	}
+}
+
+// The maximum number of ids that can be fetched in one batch lookup
+const maxBatchIDs = 100
+
+// ValidateIDs checks the ids of a batch lookup
+func ValidateIDs(v *validator.Validator, key string, ids []int64) {
+	v.Check(len(ids) > 0, key, "must contain at least one id")
+	v.Check(len(ids) <= maxBatchIDs, key, fmt.Sprintf("must not contain more than %d ids", maxBatchIDs))
+	for _, id := range ids {
+		v.Check(id > 0, key, "must only contain ids greater than zero")
+	}
 }
 
 // define a type to hold the metadata
@@ -63,22 +90,90 @@ func calculateMetaData(totalRecords int, currentPage int, pageSize int) Metadata
 
 }
 
-// Implement the sorting feature
-func (f Filters) sortColumn() string {
-	for _, safeValue := range f.SortSafeList {
-		if f.Sort == safeValue {
-			return strings.TrimPrefix(f.Sort, "-")
+// pageTotal returns the number of records a page query matches. It is
+// the COUNT(*) OVER() read from the rows of the page, except for a page
+// past the last one, which has no rows to read it from: the query then
+// runs again for its first row. The last two arguments of the query must
+// be its LIMIT and OFFSET.
+func pageTotal(ctx context.Context, db *sql.DB, totalRecords int, filters Filters, query string, args ...any) (int, error) {
+	if totalRecords > 0 || filters.Page <= 1 {
+		return totalRecords, nil
+	}
+
+	args = slices.Clone(args)
+	args[len(args)-2], args[len(args)-1] = 1, 0
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	// only the count is kept
+	dest := make([]any, len(columns))
+	dest[0] = &totalRecords
+	for i := 1; i < len(dest); i++ {
+		dest[i] = new(any)
+	}
+
+	if rows.Next() {
+		err = rows.Scan(dest...)
+		if err != nil {
+			return 0, err
 		}
 	}
-	// don't allow the operation to continue
-	// if case of SQL injection attack
-	panic("unsafe sort parameter: " + f.Sort)
+	return totalRecords, rows.Err()
+}
+
+// Split the sort parameter into its keys
+func (f Filters) sortKeys() []string {
+	keys := strings.Split(f.Sort, ",")
+	for i, key := range keys {
+		keys[i] = strings.TrimSpace(key)
+	}
+	return keys
 }
 
-// Get the sort order
-func (f Filters) sortDirection() string {
-	if strings.HasPrefix(f.Sort, "-") {
+// Get the column of a sort key
+func sortColumn(key string) string {
+	return strings.TrimPrefix(key, "-")
+}
+
+// Get the sort order of a sort key
+func sortDirection(key string) string {
+	if strings.HasPrefix(key, "-") {
 		return "DESC"
 	}
 	return "ASC"
 }
+
+// Implement the sorting feature. orderBy builds the ORDER BY list from
+// the sort keys and ends with id as a tie-breaker, so that every page
+// of the results is in a stable order.
+func (f Filters) orderBy() string {
+	var clauses []string
+	sortedByID := false
+	for _, key := range f.sortKeys() {
+		// don't allow the operation to continue
+		// if case of SQL injection attack
+		if !validator.PermittedValue(key, f.SortSafeList...) {
+			panic("unsafe sort parameter: " + f.Sort)
+		}
+		clause := sortColumn(key) + " " + sortDirection(key)
+		if slices.Contains(f.SortNullable, sortColumn(key)) {
+			clause += " NULLS LAST"
+		}
+		clauses = append(clauses, clause)
+		if sortColumn(key) == "id" {
+			sortedByID = true
+		}
+	}
+	if !sortedByID {
+		clauses = append(clauses, "id ASC")
+	}
+	return strings.Join(clauses, ", ")
+}
@@ -0,0 +1,134 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/georgie5/productReview/internal/validator"
+)
+
+func TestCalculateMetaData(t *testing.T) {
+	tests := []struct {
+		totalRecords, page, pageSize int
+		want                         Metadata
+	}{
+		{0, 1, 10, Metadata{}},
+		{1, 1, 10, Metadata{CurrentPage: 1, PageSize: 10, FirstPage: 1, LastPage: 1, TotalRecords: 1}},
+		{10, 1, 10, Metadata{CurrentPage: 1, PageSize: 10, FirstPage: 1, LastPage: 1, TotalRecords: 10}},
+		{11, 2, 10, Metadata{CurrentPage: 2, PageSize: 10, FirstPage: 1, LastPage: 2, TotalRecords: 11}},
+		// a page past the last one still reports the real last page
+		{25, 9, 10, Metadata{CurrentPage: 9, PageSize: 10, FirstPage: 1, LastPage: 3, TotalRecords: 25}},
+	}
+
+	for _, tt := range tests {
+		got := calculateMetaData(tt.totalRecords, tt.page, tt.pageSize)
+		if got != tt.want {
+			t.Errorf("calculateMetaData(%d, %d, %d) = %+v, want %+v", tt.totalRecords, tt.page, tt.pageSize, got, tt.want)
+		}
+	}
+}
+
+func TestValidateIDs(t *testing.T) {
+	many := make([]int64, maxBatchIDs+1)
+	for i := range many {
+		many[i] = int64(i + 1)
+	}
+
+	tests := []struct {
+		name  string
+		ids   []int64
+		valid bool
+	}{
+		{"one id", []int64{1}, true},
+		{"the most ids", many[:maxBatchIDs], true},
+		{"no ids", nil, false},
+		{"too many ids", many, false},
+		{"zero", []int64{1, 0}, false},
+		{"negative", []int64{-3}, false},
+	}
+
+	for _, tt := range tests {
+		v := validator.New()
+		ValidateIDs(v, "ids", tt.ids)
+		if v.IsEmpty() != tt.valid {
+			t.Errorf("%s: errors = %v, want valid %t", tt.name, v.Errors, tt.valid)
+		}
+	}
+}
+
+func TestValidateRatings(t *testing.T) {
+	tests := []struct {
+		ratings []int64
+		valid   bool
+	}{
+		{[]int64{1, 5}, true},
+		{[]int64{3}, true},
+		{[]int64{0}, false},
+		{[]int64{4, 6}, false},
+	}
+
+	for _, tt := range tests {
+		v := validator.New()
+		ValidateRatings(v, "rating", tt.ratings)
+		if v.IsEmpty() != tt.valid {
+			t.Errorf("ValidateRatings(%v): errors = %v, want valid %t", tt.ratings, v.Errors, tt.valid)
+		}
+	}
+}
+
+func TestValidateFiltersSort(t *testing.T) {
+	safeList := []string{"id", "name", "rating", "-id", "-name", "-rating"}
+
+	tests := []struct {
+		sort  string
+		valid bool
+	}{
+		{"id", true},
+		{"-rating,name", true},
+		{"rating, -name, id", true},
+		{"price", false},
+		{"name,-name", false},
+		{"name,rating,-id,id", false}, // too many keys
+		{"name;DROP TABLE products", false},
+	}
+
+	for _, tt := range tests {
+		v := validator.New()
+		ValidateFilters(v, Filters{Page: 1, PageSize: 10, Sort: tt.sort, SortSafeList: safeList})
+		if v.IsEmpty() != tt.valid {
+			t.Errorf("sort %q: errors = %v, want valid %t", tt.sort, v.Errors, tt.valid)
+		}
+	}
+}
+
+func TestOrderBy(t *testing.T) {
+	safeList := []string{"id", "rating", "sentiment_score", "-id", "-rating", "-sentiment_score"}
+
+	tests := []struct {
+		sort string
+		want string
+	}{
+		{"id", "id ASC"},
+		{"-id", "id DESC"},
+		{"rating", "rating ASC, id ASC"},
+		{"-rating, id", "rating DESC, id ASC"},
+		{"-rating,-id", "rating DESC, id DESC"},
+		{"sentiment_score", "sentiment_score ASC NULLS LAST, id ASC"},
+		{"-sentiment_score,rating", "sentiment_score DESC NULLS LAST, rating ASC, id ASC"},
+	}
+
+	for _, tt := range tests {
+		f := Filters{Sort: tt.sort, SortSafeList: safeList, SortNullable: []string{"sentiment_score"}}
+		if got := f.orderBy(); got != tt.want {
+			t.Errorf("orderBy(%q) = %q, want %q", tt.sort, got, tt.want)
+		}
+	}
+}
+
+func TestOrderByUnsafeSort(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("orderBy did not panic on a sort key missing from the safe list")
+		}
+	}()
+	Filters{Sort: "price", SortSafeList: []string{"id"}}.orderBy()
+}
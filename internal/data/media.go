@@ -0,0 +1,218 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// The path the media files are served under, followed by their key
+const MediaURLPrefix = "/v1/media/"
+
+// MediaModel wraps the database connection pool
+type MediaModel struct {
+	DB *sql.DB
+}
+
+// ReviewMedia is a photo attached to a review, with its thumbnail
+type ReviewMedia struct {
+	ID           int64     `json:"id"`
+	ReviewID     int64     `json:"review_id"`
+	Key          string    `json:"-"`
+	ThumbnailKey string    `json:"-"`
+	URL          string    `json:"url"`
+	ThumbnailURL string    `json:"thumbnail_url"`
+	ContentType  string    `json:"content_type"`
+	Width        int       `json:"width"`
+	Height       int       `json:"height"`
+	Size         int64     `json:"size"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// setURLs fills in the URLs the files are served at
+func (m *ReviewMedia) setURLs() {
+	m.URL = MediaURLPrefix + m.Key
+	m.ThumbnailURL = MediaURLPrefix + m.ThumbnailKey
+}
+
+// InsertAll records photos of a review, all of them or none. It returns
+// ErrLimitReached when the review would have more than maxPerReview
+// photos.
+func (m MediaModel) InsertAll(reviewID int64, all []*ReviewMedia, maxPerReview int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// lock the review so that concurrent uploads are counted one after
+	// the other
+	_, err = tx.ExecContext(ctx, `SELECT id FROM reviews WHERE id = $1 FOR UPDATE`, reviewID)
+	if err != nil {
+		return err
+	}
+
+	var count int
+	err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM review_media WHERE review_id = $1`, reviewID).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count+len(all) > maxPerReview {
+		return ErrLimitReached
+	}
+
+	query := `
+		INSERT INTO review_media (review_id, key, thumbnail_key, content_type, width, height, size_bytes)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at
+	`
+	for _, media := range all {
+		media.ReviewID = reviewID
+		args := []any{media.ReviewID, media.Key, media.ThumbnailKey, media.ContentType, media.Width, media.Height, media.Size}
+		err = tx.QueryRowContext(ctx, query, args...).Scan(&media.ID, &media.CreatedAt)
+		if err != nil {
+			return err
+		}
+		media.setURLs()
+	}
+
+	return tx.Commit()
+}
+
+// CountForReview returns the number of photos of a review
+func (m MediaModel) CountForReview(reviewID int64) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM review_media
+		WHERE review_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var count int
+	err := m.DB.QueryRowContext(ctx, query, reviewID).Scan(&count)
+	return count, err
+}
+
+// GetForReview returns the photos of a review, oldest first
+func (m MediaModel) GetForReview(reviewID int64) ([]*ReviewMedia, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	media, err := getMedia(ctx, m.DB, []int64{reviewID})
+	if err != nil {
+		return nil, err
+	}
+	return media, nil
+}
+
+// GetForProduct returns the photos of every review of a product
+func (m MediaModel) GetForProduct(productID int64) ([]*ReviewMedia, error) {
+	query := `
+		SELECT id
+		FROM reviews
+		WHERE product_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reviewIDs []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		reviewIDs = append(reviewIDs, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return getMedia(ctx, m.DB, reviewIDs)
+}
+
+// MediaKeys returns the keys of the files of the photos, the photos and
+// their thumbnails
+func MediaKeys(all ...*ReviewMedia) []string {
+	var keys []string
+	for _, media := range all {
+		keys = append(keys, media.Key, media.ThumbnailKey)
+	}
+	return keys
+}
+
+func getMedia(ctx context.Context, db *sql.DB, reviewIDs []int64) ([]*ReviewMedia, error) {
+	query := `
+		SELECT id, review_id, key, thumbnail_key, content_type, width, height, size_bytes, created_at
+		FROM review_media
+		WHERE review_id = ANY($1)
+		ORDER BY id
+	`
+
+	rows, err := db.QueryContext(ctx, query, pq.Array(reviewIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	all := []*ReviewMedia{}
+	for rows.Next() {
+		var media ReviewMedia
+		err := rows.Scan(
+			&media.ID,
+			&media.ReviewID,
+			&media.Key,
+			&media.ThumbnailKey,
+			&media.ContentType,
+			&media.Width,
+			&media.Height,
+			&media.Size,
+			&media.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		media.setURLs()
+		all = append(all, &media)
+	}
+
+	return all, rows.Err()
+}
+
+// attachMedia sets the Media of the reviews, with a single query for the
+// whole page
+func attachMedia(ctx context.Context, db *sql.DB, reviews ...*Review) error {
+	if len(reviews) == 0 {
+		return nil
+	}
+
+	byID := make(map[int64]*Review, len(reviews))
+	ids := make([]int64, 0, len(reviews))
+	for _, review := range reviews {
+		byID[review.ID] = review
+		ids = append(ids, review.ID)
+	}
+
+	all, err := getMedia(ctx, db, ids)
+	if err != nil {
+		return err
+	}
+	for _, media := range all {
+		review := byID[media.ReviewID]
+		review.Media = append(review.Media, media)
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// MigrationVersion returns the schema version recorded by the migrate
+// tool, and whether the last migration failed half way (dirty)
+func MigrationVersion(db *sql.DB) (int64, bool, error) {
+	query := `
+		SELECT version, dirty
+		FROM schema_migrations
+		LIMIT 1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var version int64
+	var dirty bool
+	err := db.QueryRowContext(ctx, query).Scan(&version, &dirty)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, false, ErrRecordNotFound
+		default:
+			return 0, false, err
+		}
+	}
+	return version, dirty, nil
+}
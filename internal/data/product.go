@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/georgie5/productReview/internal/validator"
+	"github.com/lib/pq"
 )
 
 // ProductModel wraps the database connection pool
@@ -17,12 +18,13 @@ type ProductModel struct {
 
 // Product represents a product in the catalog
 type Product struct {
-	ID            int64   `json:"id"`
-	Name          string  `json:"name"`
-	Category      string  `json:"category"`
-	ImageURL      string  `json:"image_url"`
-	AverageRating float64 `json:"average_rating"`
-	Version       int32   `json:"version"` // incremented on each update
+	ID            int64           `json:"id"`
+	Name          string          `json:"name"`
+	Category      string          `json:"category"`
+	ImageURL      string          `json:"image_url"` // optional link to an image hosted elsewhere
+	AverageRating float64         `json:"average_rating"`
+	Images        []*ProductImage `json:"images"`  // uploaded images, in order
+	Version       int32           `json:"version"` // incremented on each update
 }
 
 func ValidateProduct(v *validator.Validator, p *Product) {
@@ -30,11 +32,15 @@ func ValidateProduct(v *validator.Validator, p *Product) {
 	v.Check(len(p.Name) <= 100, "name", "must not be more than 100 characters")
 	v.Check(p.Category != "", "category", "must be provided")
 	v.Check(len(p.Category) <= 50, "category", "must not be more than 50 characters")
-	v.Check(p.ImageURL != "", "image_url", "must be provided")
-	v.Check(len(p.ImageURL) <= 255, "image_url", "must not be more than 255 characters")
+	if p.ImageURL != "" {
+		v.Check(len(p.ImageURL) <= 255, "image_url", "must not be more than 255 characters")
+		v.Check(validator.IsURL(p.ImageURL), "image_url", "must be an http or https URL")
+	}
 
 }
 
+// Insert stores a new product, or returns ErrDuplicateRecord when a
+// product with the same name and category exists
 func (p ProductModel) Insert(product *Product) error {
 	query := `
 		INSERT INTO products (name, category, image_url, average_rating)
@@ -46,7 +52,13 @@ func (p ProductModel) Insert(product *Product) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	return p.DB.QueryRowContext(ctx, query, args...).Scan(&product.ID, &product.Version)
+	// a new product has no images yet
+	product.Images = []*ProductImage{}
+	err := p.DB.QueryRowContext(ctx, query, args...).Scan(&product.ID, &product.Version)
+	if isUniqueViolation(err) {
+		return ErrDuplicateRecord
+	}
+	return err
 
 }
 
@@ -86,24 +98,39 @@ func (c ProductModel) Get(id int64) (*Product, error) {
 			return nil, err
 		}
 	}
+
+	err = attachImages(ctx, c.DB, &product)
+	if err != nil {
+		return nil, err
+	}
 	return &product, nil
 }
 
+// Update saves the product, or returns ErrDuplicateRecord when another
+// product has the same name and category
 func (p ProductModel) Update(product *Product) error {
 
 	query := `
 	UPDATE products
 	SET name = $1, category = $2, image_url = $3, version = version + 1
-	WHERE id = $4
+	WHERE id = $4 AND version = $5
 	RETURNING version
 	`
-	args := []any{product.Name, product.Category, product.ImageURL, product.ID}
+	args := []any{product.Name, product.Category, product.ImageURL, product.ID, product.Version}
 
 	// Set a 3-second context/timer
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	return p.DB.QueryRowContext(ctx, query, args...).Scan(&product.Version)
+	// no row means the product changed, or was deleted, since it was read
+	err := p.DB.QueryRowContext(ctx, query, args...).Scan(&product.Version)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return ErrEditConflict
+	case isUniqueViolation(err):
+		return ErrDuplicateRecord
+	}
+	return err
 
 }
 
@@ -141,20 +168,30 @@ func (p ProductModel) Delete(id int64) error {
 
 }
 
-func (p ProductModel) GetAll(name string, category string, filters Filters) ([]*Product, Metadata, error) {
+// GetAll returns a page of products. A product matches the categories
+// filter when its category contains any of the given values, and a nil
+// categories slice does not filter at all.
+func (p ProductModel) GetAll(name string, categories []string, filters Filters) ([]*Product, Metadata, error) {
 
 	query := fmt.Sprintf(`
 		SELECT COUNT(*) OVER(), id, name, category, image_url, average_rating, version
 		FROM products
 		WHERE (name ILIKE '%%' || $1 || '%%' OR $1 = '')
-		AND (category ILIKE '%%' || $2 || '%%' OR $2 = '')
-		ORDER BY %s %s, id ASC
-		LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+		AND ($2::text[] IS NULL OR category ILIKE ANY($2))
+		ORDER BY %s
+		LIMIT $3 OFFSET $4`, filters.orderBy())
+
+	// match each category anywhere in the column, like the name search
+	var categoryPatterns []string
+	for _, category := range categories {
+		categoryPatterns = append(categoryPatterns, "%"+category+"%")
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	rows, err := p.DB.QueryContext(ctx, query, name, category, filters.limit(), filters.offset())
+	args := []any{name, pq.Array(categoryPatterns), filters.limit(), filters.offset()}
+	rows, err := p.DB.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, Metadata{}, err
 	}
@@ -183,17 +220,84 @@ func (p ProductModel) GetAll(name string, category string, filters Filters) ([]*
 		return nil, Metadata{}, err
 	}
 
+	err = attachImages(ctx, p.DB, products...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	totalRecords, err = pageTotal(ctx, p.DB, totalRecords, filters, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
 	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
 	return products, metadata, nil
 }
 
+// GetByIDs fetches the products with the given ids in the order they
+// were requested, along with the ids that do not exist
+func (p ProductModel) GetByIDs(ids []int64) ([]*Product, []int64, error) {
+	query := `
+		SELECT id, name, category, image_url, average_rating, version
+		FROM products
+		WHERE id = ANY($1)
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := p.DB.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	found := make(map[int64]*Product, len(ids))
+	for rows.Next() {
+		var product Product
+		err := rows.Scan(
+			&product.ID,
+			&product.Name,
+			&product.Category,
+			&product.ImageURL,
+			&product.AverageRating,
+			&product.Version,
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+		found[product.ID] = &product
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	products := []*Product{}
+	missing := []int64{}
+	for _, id := range ids {
+		product, ok := found[id]
+		if !ok {
+			missing = append(missing, id)
+			continue
+		}
+		products = append(products, product)
+	}
+
+	err = attachImages(ctx, p.DB, products...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return products, missing, nil
+}
+
 func (p ProductModel) UpdateAverageRating(productID int64) error {
 	query := `
 		UPDATE products
 		SET average_rating = (
 			SELECT COALESCE(AVG(rating), 0)
 			FROM reviews
-			WHERE product_id = $1
+			WHERE product_id = $1 AND status = 'approved'
 		)
 		WHERE id = $1
 	`
@@ -204,3 +308,60 @@ func (p ProductModel) UpdateAverageRating(productID int64) error {
 	_, err := p.DB.ExecContext(ctx, query, productID)
 	return err
 }
+
+// GetByNaturalKey looks up a product by its name and category, which
+// together identify a product in the catalogue
+func (p ProductModel) GetByNaturalKey(name string, category string) (*Product, error) {
+	query := `
+		SELECT id, name, category, image_url, average_rating, version
+		FROM products
+		WHERE name = $1 AND category = $2
+	`
+	var product Product
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := p.DB.QueryRowContext(ctx, query, name, category).Scan(
+		&product.ID,
+		&product.Name,
+		&product.Category,
+		&product.ImageURL,
+		&product.AverageRating,
+		&product.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &product, nil
+}
+
+// Upsert inserts the product, or updates the existing product with the
+// same name and category. It reports whether a new row was created.
+func (p ProductModel) Upsert(product *Product) (bool, error) {
+	query := `
+		INSERT INTO products (name, category, image_url, average_rating)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (name, category) DO UPDATE
+		SET image_url = EXCLUDED.image_url, version = products.version + 1
+		RETURNING id, average_rating, version, (xmax = 0) AS inserted
+	`
+	args := []any{product.Name, product.Category, product.ImageURL, product.AverageRating}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var inserted bool
+	err := p.DB.QueryRowContext(ctx, query, args...).Scan(
+		&product.ID,
+		&product.AverageRating,
+		&product.Version,
+		&inserted,
+	)
+	return inserted, err
+}
@@ -0,0 +1,516 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ProductImageModel wraps the database connection pool
+type ProductImageModel struct {
+	DB *sql.DB
+}
+
+// ProductImage is an uploaded picture of a product, stored with resized
+// variants. The images of a product are ordered by Position, starting at
+// 1, and one of them is the primary image.
+type ProductImage struct {
+	ID          int64            `json:"id"`
+	ProductID   int64            `json:"product_id"`
+	Hash        string           `json:"-"` // SHA-256 of the original file
+	Keys        ProductImageKeys `json:"-"`
+	URLs        ProductImageURLs `json:"urls"`
+	ContentType string           `json:"content_type"`
+	Width       int              `json:"width"`
+	Height      int              `json:"height"`
+	Size        int64            `json:"size"`
+	Position    int              `json:"position"`
+	Primary     bool             `json:"primary"`
+	CreatedAt   time.Time        `json:"created_at"`
+}
+
+// ProductImageKeys are the blob store keys of the files of an image
+type ProductImageKeys struct {
+	Original string
+	Thumb    string
+	Medium   string
+	Large    string
+}
+
+// All returns every key, for deleting the files
+func (k ProductImageKeys) All() []string {
+	return []string{k.Original, k.Thumb, k.Medium, k.Large}
+}
+
+// ProductImageURLs are the URLs the files of an image are served at
+type ProductImageURLs struct {
+	Original string `json:"original"`
+	Thumb    string `json:"thumb"`
+	Medium   string `json:"medium"`
+	Large    string `json:"large"`
+}
+
+// setURLs fills in the URLs the files are served at
+func (i *ProductImage) setURLs() {
+	i.URLs = ProductImageURLs{
+		Original: MediaURLPrefix + i.Keys.Original,
+		Thumb:    MediaURLPrefix + i.Keys.Thumb,
+		Medium:   MediaURLPrefix + i.Keys.Medium,
+		Large:    MediaURLPrefix + i.Keys.Large,
+	}
+}
+
+const productImageColumns = `id, product_id, hash, original_key, thumb_key, medium_key, large_key,
+	content_type, width, height, size_bytes, position, is_primary, created_at`
+
+func scanProductImage(row rowScanner, image *ProductImage) error {
+	err := row.Scan(
+		&image.ID,
+		&image.ProductID,
+		&image.Hash,
+		&image.Keys.Original,
+		&image.Keys.Thumb,
+		&image.Keys.Medium,
+		&image.Keys.Large,
+		&image.ContentType,
+		&image.Width,
+		&image.Height,
+		&image.Size,
+		&image.Position,
+		&image.Primary,
+		&image.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	image.setURLs()
+	return nil
+}
+
+// Insert adds an image after the other images of its product, calling
+// writeFiles to store its files first. The first image of a product
+// becomes its primary image. It returns ErrDuplicateRecord when the
+// product already has the same image, and ErrLimitReached when the
+// product has maxPerProduct images. The files may have been written by
+// then when a concurrent upload took the last place.
+func (m ProductImageModel) Insert(image *ProductImage, maxPerProduct int, writeFiles func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// the files are shared with the other products that have the same
+	// image, they must not be deleted while they are written nor before
+	// the image that uses them is recorded
+	err = lockHash(ctx, tx, image.Hash)
+	if err != nil {
+		return err
+	}
+
+	// skip writing the files when the image cannot be added anyway
+	err = checkProductImageRoom(ctx, tx, image, maxPerProduct)
+	if err != nil {
+		return err
+	}
+	err = writeFiles(ctx)
+	if err != nil {
+		return err
+	}
+
+	// concurrent uploads to the product are numbered one after the
+	// other, and only one of them can be its first image. The row is
+	// locked once the files are written, so slow writes do not hold up
+	// the other changes to the images of the product.
+	err = lockProduct(ctx, tx, image.ProductID)
+	if err != nil {
+		return err
+	}
+	err = checkProductImageRoom(ctx, tx, image, maxPerProduct)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO product_images (product_id, hash, original_key, thumb_key, medium_key, large_key,
+			content_type, width, height, size_bytes, position, is_primary)
+		SELECT $1::bigint, $2::text, $3::text, $4::text, $5::text, $6::text,
+			$7::text, $8::integer, $9::integer, $10::bigint, COALESCE(MAX(position), 0) + 1, COUNT(*) = 0
+		FROM product_images
+		WHERE product_id = $1
+		RETURNING id, position, is_primary, created_at
+	`
+	args := []any{
+		image.ProductID, image.Hash, image.Keys.Original, image.Keys.Thumb, image.Keys.Medium, image.Keys.Large,
+		image.ContentType, image.Width, image.Height, image.Size,
+	}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&image.ID, &image.Position, &image.Primary, &image.CreatedAt)
+	if err != nil {
+		return err
+	}
+	image.setURLs()
+	return tx.Commit()
+}
+
+// checkProductImageRoom returns ErrDuplicateRecord when the product
+// already has the image, and ErrLimitReached when it has no room left
+func checkProductImageRoom(ctx context.Context, tx *sql.Tx, image *ProductImage, maxPerProduct int) error {
+	var count int
+	var duplicate bool
+	err := tx.QueryRowContext(ctx, `
+		SELECT COUNT(*), COALESCE(bool_or(hash = $2), false)
+		FROM product_images
+		WHERE product_id = $1`, image.ProductID, image.Hash).Scan(&count, &duplicate)
+	if err != nil {
+		return err
+	}
+	if duplicate {
+		return ErrDuplicateRecord
+	}
+	if count >= maxPerProduct {
+		return ErrLimitReached
+	}
+	return nil
+}
+
+// lockProduct locks the row of a product until the end of the
+// transaction, which serializes the changes to the order and the primary
+// image of its images
+func lockProduct(ctx context.Context, tx *sql.Tx, productID int64) error {
+	err := tx.QueryRowContext(ctx, `SELECT id FROM products WHERE id = $1 FOR UPDATE`, productID).Scan(&productID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrRecordNotFound
+	}
+	return err
+}
+
+// The first key of the advisory locks on image hashes, which keeps them
+// apart from any other advisory lock
+const imageHashLockClass = 4701
+
+// lockHash takes an advisory lock on an image hash until the end of the
+// transaction. Writing and deleting the files of a hash both hold it.
+func lockHash(ctx context.Context, tx *sql.Tx, hash string) error {
+	_, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1, hashtext($2))`, imageHashLockClass, hash)
+	return err
+}
+
+// Get returns an image of a product
+func (m ProductImageModel) Get(productID int64, id int64) (*ProductImage, error) {
+	if productID < 1 || id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT ` + productImageColumns + `
+		FROM product_images
+		WHERE product_id = $1 AND id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var image ProductImage
+	err := scanProductImage(m.DB.QueryRowContext(ctx, query, productID, id), &image)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &image, nil
+}
+
+// GetByHash returns the image of a product with the given content hash
+func (m ProductImageModel) GetByHash(productID int64, hash string) (*ProductImage, error) {
+	query := `
+		SELECT ` + productImageColumns + `
+		FROM product_images
+		WHERE product_id = $1 AND hash = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var image ProductImage
+	err := scanProductImage(m.DB.QueryRowContext(ctx, query, productID, hash), &image)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &image, nil
+}
+
+// GetForProduct returns the images of a product in order
+func (m ProductImageModel) GetForProduct(productID int64) ([]*ProductImage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return getProductImages(ctx, m.DB, []int64{productID})
+}
+
+// CountForProduct returns the number of images of a product
+func (m ProductImageModel) CountForProduct(productID int64) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM product_images
+		WHERE product_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var count int
+	err := m.DB.QueryRowContext(ctx, query, productID).Scan(&count)
+	return count, err
+}
+
+// Move puts an image at a new position, shifting the images in between.
+// Positions past the last image move it to the end.
+func (m ProductImageModel) Move(image *ProductImage, position int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// lock the product while its images are renumbered
+	err = lockProduct(ctx, tx, image.ProductID)
+	if err != nil {
+		return err
+	}
+
+	var count int
+	err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM product_images WHERE product_id = $1`, image.ProductID).Scan(&count)
+	if err != nil {
+		return err
+	}
+
+	var current int
+	err = tx.QueryRowContext(ctx, `SELECT position FROM product_images WHERE id = $1`, image.ID).Scan(&current)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
+		return err
+	}
+
+	position = min(max(position, 1), count)
+	switch {
+	case position < current:
+		_, err = tx.ExecContext(ctx, `
+			UPDATE product_images SET position = position + 1
+			WHERE product_id = $1 AND position >= $2 AND position < $3`,
+			image.ProductID, position, current)
+	case position > current:
+		_, err = tx.ExecContext(ctx, `
+			UPDATE product_images SET position = position - 1
+			WHERE product_id = $1 AND position > $2 AND position <= $3`,
+			image.ProductID, current, position)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE product_images SET position = $1 WHERE id = $2`, position, image.ID)
+	if err != nil {
+		return err
+	}
+
+	image.Position = position
+	return tx.Commit()
+}
+
+// SetPrimary makes an image the primary image of its product
+func (m ProductImageModel) SetPrimary(image *ProductImage) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = lockProduct(ctx, tx, image.ProductID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE product_images SET is_primary = false
+		WHERE product_id = $1 AND is_primary AND id <> $2`, image.ProductID, image.ID)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, `UPDATE product_images SET is_primary = true WHERE id = $1`, image.ID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	image.Primary = true
+	return tx.Commit()
+}
+
+// Delete removes an image and closes the gap it leaves in the order. When
+// it was the primary image, the first remaining image takes its place.
+func (m ProductImageModel) Delete(image *ProductImage) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = lockProduct(ctx, tx, image.ProductID)
+	if err != nil {
+		return err
+	}
+
+	var position int
+	var primary bool
+	err = tx.QueryRowContext(ctx, `
+		DELETE FROM product_images
+		WHERE id = $1
+		RETURNING position, is_primary`, image.ID).Scan(&position, &primary)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE product_images SET position = position - 1
+		WHERE product_id = $1 AND position > $2`, image.ProductID, position)
+	if err != nil {
+		return err
+	}
+
+	if primary {
+		_, err = tx.ExecContext(ctx, `
+			UPDATE product_images SET is_primary = true
+			WHERE id = (
+				SELECT id FROM product_images
+				WHERE product_id = $1
+				ORDER BY position
+				LIMIT 1
+			)`, image.ProductID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DeleteUnusedFiles calls deleteFiles unless a product still has an
+// image with the hash, in which case its files must be kept. An upload of
+// the same image waits until the files are deleted, then writes them
+// again.
+func (m ProductImageModel) DeleteUnusedFiles(hash string, deleteFiles func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = lockHash(ctx, tx, hash)
+	if err != nil {
+		return err
+	}
+
+	var inUse bool
+	err = tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM product_images WHERE hash = $1)`, hash).Scan(&inUse)
+	if err != nil || inUse {
+		return err
+	}
+
+	err = deleteFiles(ctx)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func getProductImages(ctx context.Context, db *sql.DB, productIDs []int64) ([]*ProductImage, error) {
+	query := `
+		SELECT ` + productImageColumns + `
+		FROM product_images
+		WHERE product_id = ANY($1)
+		ORDER BY product_id, position
+	`
+
+	rows, err := db.QueryContext(ctx, query, pq.Array(productIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	images := []*ProductImage{}
+	for rows.Next() {
+		var image ProductImage
+		err := scanProductImage(rows, &image)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, &image)
+	}
+
+	return images, rows.Err()
+}
+
+// attachImages sets the Images of the products, with a single query for
+// the whole page
+func attachImages(ctx context.Context, db *sql.DB, products ...*Product) error {
+	if len(products) == 0 {
+		return nil
+	}
+
+	byID := make(map[int64]*Product, len(products))
+	ids := make([]int64, 0, len(products))
+	for _, product := range products {
+		product.Images = []*ProductImage{}
+		byID[product.ID] = product
+		ids = append(ids, product.ID)
+	}
+
+	images, err := getProductImages(ctx, db, ids)
+	if err != nil {
+		return err
+	}
+	for _, image := range images {
+		product := byID[image.ProductID]
+		product.Images = append(product.Images, image)
+	}
+	return nil
+}
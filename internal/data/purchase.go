@@ -0,0 +1,138 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/georgie5/productReview/internal/validator"
+)
+
+// PurchaseModel wraps the database connection pool
+type PurchaseModel struct {
+	DB *sql.DB
+}
+
+// Purchase records that the owner of an email address bought a product.
+// Purchases are imported from the order system, and each order verifies
+// one review of the buyer.
+type Purchase struct {
+	ID          int64     `json:"id"`
+	ProductID   int64     `json:"product_id"`
+	Email       string    `json:"email"`
+	OrderID     string    `json:"order_id,omitempty"` // reference in the order system
+	PurchasedAt time.Time `json:"purchased_at"`
+	CreatedAt   time.Time `json:"-"`
+}
+
+// PurchaseProof is what a reviewer sends to show they bought the product:
+// the email and the order id of their purchase, which only the buyer
+// knows together
+type PurchaseProof struct {
+	Email   string `json:"email"`
+	OrderID string `json:"order_id"`
+}
+
+// NormalizeEmail returns the form emails are stored and matched in
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// ValidateEmail checks an email address
+func ValidateEmail(v *validator.Validator, key string, email string) {
+	v.Check(email != "", key, "must be provided")
+	v.Check(len(email) <= 254, key, "must not be more than 254 characters long")
+	v.Check(validator.Matches(email, validator.EmailRX), key, "must be a valid email address")
+}
+
+// ValidatePurchaseProof checks a purchase sent with a review, both
+// fields are needed
+func ValidatePurchaseProof(v *validator.Validator, proof *PurchaseProof) {
+	ValidateEmail(v, "purchase.email", proof.Email)
+	v.Check(proof.OrderID != "", "purchase.order_id", "must be provided")
+	v.Check(len(proof.OrderID) <= 100, "purchase.order_id", "must not be more than 100 characters long")
+}
+
+func ValidatePurchase(v *validator.Validator, purchase *Purchase) {
+	v.Check(purchase.ProductID > 0, "product_id", "must be greater than zero")
+	ValidateEmail(v, "email", purchase.Email)
+	v.Check(purchase.OrderID != "", "order_id", "must be provided")
+	v.Check(len(purchase.OrderID) <= 100, "order_id", "must not be more than 100 characters long")
+	v.Check(!purchase.PurchasedAt.IsZero(), "purchased_at", "must be provided")
+	v.Check(!purchase.PurchasedAt.After(time.Now()), "purchased_at", "must not be in the future")
+}
+
+// Insert stores a purchase. It reports false when the same order was
+// already imported.
+func (m PurchaseModel) Insert(purchase *Purchase) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return insertPurchase(ctx, m.DB, purchase)
+}
+
+// InsertAll stores a batch of purchases in a single transaction and
+// returns how many were not imported before
+func (m PurchaseModel) InsertAll(purchases []*Purchase) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	inserted := 0
+	for _, purchase := range purchases {
+		ok, err := insertPurchase(ctx, tx, purchase)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			inserted++
+		}
+	}
+
+	return inserted, tx.Commit()
+}
+
+// rowQuerier is a *sql.DB or *sql.Tx
+type rowQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func insertPurchase(ctx context.Context, db rowQuerier, purchase *Purchase) (bool, error) {
+	query := `
+		INSERT INTO purchases (product_id, email, order_id, purchased_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (product_id, email, order_id) DO NOTHING
+		RETURNING id, created_at
+	`
+	args := []any{purchase.ProductID, NormalizeEmail(purchase.Email), purchase.OrderID, purchase.PurchasedAt}
+
+	err := db.QueryRowContext(ctx, query, args...).Scan(&purchase.ID, &purchase.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Imported tells whether the same order was already imported
+func (m PurchaseModel) Imported(purchase *Purchase) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM purchases
+			WHERE product_id = $1 AND email = $2 AND order_id = $3
+		)
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var imported bool
+	err := m.DB.QueryRowContext(ctx, query, purchase.ProductID, NormalizeEmail(purchase.Email), purchase.OrderID).Scan(&imported)
+	return imported, err
+}
@@ -0,0 +1,62 @@
+package data
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/georgie5/productReview/internal/validator"
+)
+
+func TestValidatePurchase(t *testing.T) {
+	valid := func() Purchase {
+		return Purchase{ProductID: 1, Email: "ana@example.com", OrderID: "A-1001", PurchasedAt: time.Now().Add(-time.Hour)}
+	}
+
+	tests := []struct {
+		name    string
+		change  func(p *Purchase)
+		invalid []string
+	}{
+		{name: "valid", change: func(p *Purchase) {}},
+		{name: "no product", change: func(p *Purchase) { p.ProductID = 0 }, invalid: []string{"product_id"}},
+		{name: "invalid email", change: func(p *Purchase) { p.Email = "ana" }, invalid: []string{"email"}},
+		{name: "no order id", change: func(p *Purchase) { p.OrderID = "" }, invalid: []string{"order_id"}},
+		{name: "order id too long", change: func(p *Purchase) { p.OrderID = strings.Repeat("1", 101) }, invalid: []string{"order_id"}},
+		{name: "no date", change: func(p *Purchase) { p.PurchasedAt = time.Time{} }, invalid: []string{"purchased_at"}},
+		{name: "future date", change: func(p *Purchase) { p.PurchasedAt = time.Now().Add(time.Hour) }, invalid: []string{"purchased_at"}},
+	}
+
+	for _, tt := range tests {
+		purchase := valid()
+		tt.change(&purchase)
+		v := validator.New()
+		ValidatePurchase(v, &purchase)
+		checkErrors(t, tt.name, v, tt.invalid)
+	}
+}
+
+func TestValidatePurchaseProof(t *testing.T) {
+	tests := []struct {
+		name    string
+		proof   PurchaseProof
+		invalid []string
+	}{
+		{name: "valid", proof: PurchaseProof{Email: "ana@example.com", OrderID: "A-1001"}},
+		{name: "email only", proof: PurchaseProof{Email: "ana@example.com"}, invalid: []string{"purchase.order_id"}},
+		{name: "order id only", proof: PurchaseProof{OrderID: "A-1001"}, invalid: []string{"purchase.email"}},
+		{name: "order id too long", proof: PurchaseProof{Email: "ana@example.com", OrderID: strings.Repeat("1", 101)}, invalid: []string{"purchase.order_id"}},
+	}
+
+	for _, tt := range tests {
+		v := validator.New()
+		ValidatePurchaseProof(v, &tt.proof)
+		checkErrors(t, tt.name, v, tt.invalid)
+	}
+}
+
+func TestNormalizeEmail(t *testing.T) {
+	if got := NormalizeEmail("  Ana@Example.COM "); got != "ana@example.com" {
+		t.Errorf(`NormalizeEmail("  Ana@Example.COM ") = %q, want "ana@example.com"`, got)
+	}
+}
@@ -0,0 +1,148 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/georgie5/productReview/internal/validator"
+)
+
+// The reasons a shopper can give when reporting a review
+var ReportReasons = []string{"spam", "abusive", "off_topic", "fake", "other"}
+
+// ReportModel wraps the database connection pool
+type ReportModel struct {
+	DB *sql.DB
+}
+
+// Report is a shopper telling the moderators that a review is abusive
+type Report struct {
+	ID        int64     `json:"id"`
+	ReviewID  int64     `json:"review_id"`
+	Reporter  string    `json:"reporter"` // a hash of the reporter's address
+	Reason    string    `json:"reason"`
+	Note      string    `json:"note,omitempty"`
+	Resolved  bool      `json:"resolved"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func ValidateReport(v *validator.Validator, report *Report) {
+	v.Check(validator.PermittedValue(report.Reason, ReportReasons...), "reason", "must be one of spam, abusive, off_topic, fake or other")
+	v.Check(len(report.Note) <= 500, "note", "must not be more than 500 characters long")
+}
+
+// Insert stores a report. It returns false, and leaves the first report
+// as it was, when the reporter already reported the review.
+func (m ReportModel) Insert(report *Report) (bool, error) {
+	query := `
+		INSERT INTO review_reports (review_id, reporter, reason, note)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (review_id, reporter) DO NOTHING
+		RETURNING id, resolved, created_at
+	`
+	args := []any{report.ReviewID, report.Reporter, report.Reason, report.Note}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&report.ID, &report.Resolved, &report.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// CountUnresolved returns the number of distinct reporters whose reports
+// of the review no moderator has looked at
+func (m ReportModel) CountUnresolved(reviewID int64) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM review_reports
+		WHERE review_id = $1 AND NOT resolved
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var count int
+	err := m.DB.QueryRowContext(ctx, query, reviewID).Scan(&count)
+	return count, err
+}
+
+// ResolveForReview marks the reports of a review as dealt with, once a
+// moderator decided about the review
+func (m ReportModel) ResolveForReview(reviewID int64) error {
+	query := `
+		UPDATE review_reports
+		SET resolved = true
+		WHERE review_id = $1 AND NOT resolved
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, reviewID)
+	return err
+}
+
+// GetAll returns a page of reports. A reviewID of 0 matches every review
+// and a nil resolved matches resolved and unresolved reports.
+func (m ReportModel) GetAll(reviewID int64, resolved *bool, filters Filters) ([]*Report, Metadata, error) {
+
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), id, review_id, reporter, reason, note, resolved, created_at
+		FROM review_reports
+		WHERE ($1 = 0 OR review_id = $1)
+		AND ($2::boolean IS NULL OR resolved = $2)
+		ORDER BY %s
+		LIMIT $3 OFFSET $4`, filters.orderBy())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []any{reviewID, resolved, filters.limit(), filters.offset()}
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	reports := []*Report{}
+	totalRecords := 0
+
+	for rows.Next() {
+		var report Report
+		err := rows.Scan(
+			&totalRecords,
+			&report.ID,
+			&report.ReviewID,
+			&report.Reporter,
+			&report.Reason,
+			&report.Note,
+			&report.Resolved,
+			&report.CreatedAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		reports = append(reports, &report)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	totalRecords, err = pageTotal(ctx, m.DB, totalRecords, filters, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
+	return reports, metadata, nil
+}
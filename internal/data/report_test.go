@@ -0,0 +1,28 @@
+package data
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/georgie5/productReview/internal/validator"
+)
+
+func TestValidateReport(t *testing.T) {
+	tests := []struct {
+		name    string
+		report  Report
+		invalid []string
+	}{
+		{name: "valid", report: Report{Reason: "spam"}},
+		{name: "with a note", report: Report{Reason: "other", Note: "Copied from another site"}},
+		{name: "no reason", report: Report{}, invalid: []string{"reason"}},
+		{name: "unknown reason", report: Report{Reason: "boring"}, invalid: []string{"reason"}},
+		{name: "note too long", report: Report{Reason: "fake", Note: strings.Repeat("a", 501)}, invalid: []string{"note"}},
+	}
+
+	for _, tt := range tests {
+		v := validator.New()
+		ValidateReport(v, &tt.report)
+		checkErrors(t, tt.name, v, tt.invalid)
+	}
+}
@@ -0,0 +1,191 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/georgie5/productReview/internal/validator"
+	"github.com/lib/pq"
+)
+
+// ResponseModel wraps the database connection pool
+type ResponseModel struct {
+	DB *sql.DB
+}
+
+// ReviewResponse is the official reply of the merchant to a review. A
+// review has at most one.
+type ReviewResponse struct {
+	ID        int64     `json:"id"`
+	ReviewID  int64     `json:"review_id"`
+	Author    string    `json:"author"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Version   int32     `json:"version"`
+}
+
+func ValidateResponse(v *validator.Validator, response *ReviewResponse) {
+	v.Check(response.Author != "", "author", "must be provided")
+	v.Check(len(response.Author) <= 100, "author", "must not be more than 100 characters long")
+	v.Check(response.Content != "", "content", "must be provided")
+	v.Check(len(response.Content) <= 1000, "content", "must not be more than 1000 characters long")
+}
+
+// Insert stores the response to a review, or returns ErrDuplicateRecord
+// when the review already has one
+func (m ResponseModel) Insert(response *ReviewResponse) error {
+	query := `
+		INSERT INTO review_responses (review_id, author, content)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (review_id) DO NOTHING
+		RETURNING id, created_at, updated_at, version
+	`
+	args := []any{response.ReviewID, response.Author, response.Content}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
+		&response.ID,
+		&response.CreatedAt,
+		&response.UpdatedAt,
+		&response.Version,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrDuplicateRecord
+	}
+	return err
+}
+
+// Get returns the response to a review
+func (m ResponseModel) Get(reviewID int64) (*ReviewResponse, error) {
+	if reviewID < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, review_id, author, content, created_at, updated_at, version
+		FROM review_responses
+		WHERE review_id = $1
+	`
+
+	var response ReviewResponse
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, reviewID).Scan(
+		&response.ID,
+		&response.ReviewID,
+		&response.Author,
+		&response.Content,
+		&response.CreatedAt,
+		&response.UpdatedAt,
+		&response.Version,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+func (m ResponseModel) Update(response *ReviewResponse) error {
+	query := `
+		UPDATE review_responses
+		SET author = $1, content = $2, updated_at = NOW(), version = version + 1
+		WHERE review_id = $3 AND version = $4
+		RETURNING updated_at, version
+	`
+	args := []any{response.Author, response.Content, response.ReviewID, response.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&response.UpdatedAt, &response.Version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrEditConflict
+	}
+	return err
+}
+
+func (m ResponseModel) Delete(reviewID int64) error {
+	if reviewID < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM review_responses
+		WHERE review_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, reviewID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// attachResponses sets the Response of the reviews that have one, with a
+// single query for the whole page
+func attachResponses(ctx context.Context, db *sql.DB, reviews ...*Review) error {
+	if len(reviews) == 0 {
+		return nil
+	}
+
+	byID := make(map[int64]*Review, len(reviews))
+	ids := make([]int64, 0, len(reviews))
+	for _, review := range reviews {
+		byID[review.ID] = review
+		ids = append(ids, review.ID)
+	}
+
+	query := `
+		SELECT id, review_id, author, content, created_at, updated_at, version
+		FROM review_responses
+		WHERE review_id = ANY($1)
+	`
+
+	rows, err := db.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var response ReviewResponse
+		err := rows.Scan(
+			&response.ID,
+			&response.ReviewID,
+			&response.Author,
+			&response.Content,
+			&response.CreatedAt,
+			&response.UpdatedAt,
+			&response.Version,
+		)
+		if err != nil {
+			return err
+		}
+		byID[response.ReviewID].Response = &response
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,30 @@
+package data
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/georgie5/productReview/internal/validator"
+)
+
+func TestValidateResponse(t *testing.T) {
+	tests := []struct {
+		name     string
+		response ReviewResponse
+		invalid  []string
+	}{
+		{name: "valid", response: ReviewResponse{Author: "Support team", Content: "Sorry to hear that"}},
+		{name: "no author", response: ReviewResponse{Content: "Sorry to hear that"}, invalid: []string{"author"}},
+		{name: "author too long", response: ReviewResponse{Author: strings.Repeat("a", 101), Content: "Thanks"}, invalid: []string{"author"}},
+		{name: "no content", response: ReviewResponse{Author: "Support team"}, invalid: []string{"content"}},
+		{name: "longest content", response: ReviewResponse{Author: "Support team", Content: strings.Repeat("a", 1000)}},
+		{name: "content too long", response: ReviewResponse{Author: "Support team", Content: strings.Repeat("a", 1001)}, invalid: []string{"content"}},
+		{name: "empty", invalid: []string{"author", "content"}},
+	}
+
+	for _, tt := range tests {
+		v := validator.New()
+		ValidateResponse(v, &tt.response)
+		checkErrors(t, tt.name, v, tt.invalid)
+	}
+}
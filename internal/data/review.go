@@ -5,9 +5,12 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/georgie5/productReview/internal/sentiment"
 	"github.com/georgie5/productReview/internal/validator"
+	"github.com/lib/pq"
 )
 
 // ReviewModel wraps the database connection pool
@@ -15,15 +18,100 @@ type ReviewModel struct {
 	DB *sql.DB
 }
 
+// The moderation status of a review. Only approved reviews are listed and
+// count toward the average rating of their product. Hidden reviews were
+// reported too many times and wait for a moderator.
+const (
+	ReviewStatusPending  = "pending"
+	ReviewStatusApproved = "approved"
+	ReviewStatusRejected = "rejected"
+	ReviewStatusHidden   = "hidden"
+)
+
 // Review represents a product review
 type Review struct {
-	ID           int64     `json:"id"`
-	ProductID    int64     `json:"product_id"`
-	Rating       int       `json:"rating"`
-	Content      string    `json:"content"`
-	HelpfulCount int       `json:"helpful_count"`
-	CreatedAt    time.Time `json:"-"`
-	Version      int32     `json:"version"`
+	ID               int64      `json:"id"`
+	ProductID        int64      `json:"product_id"`
+	Rating           int        `json:"rating"`
+	Content          string     `json:"content"`
+	HelpfulCount     int        `json:"helpful_count"`
+	VerifiedPurchase bool       `json:"verified_purchase"` // the reviewer bought the product
+	CommentCount     int        `json:"comment_count"`     // published comments
+	Status           string     `json:"status"`
+	RejectionReason  string     `json:"rejection_reason,omitempty"`
+	ModeratedAt      *time.Time `json:"moderated_at,omitempty"`
+
+	// when the rating or content last changed, and how many earlier
+	// versions are kept as revisions
+	EditedAt      *time.Time `json:"edited_at,omitempty"`
+	RevisionCount int        `json:"revision_count"`
+
+	// how positive the content is, from -1 to 1, and the label of the
+	// score; missing until the review is scored
+	SentimentScore *float64 `json:"sentiment_score,omitempty"`
+	SentimentLabel string   `json:"sentiment_label,omitempty"`
+
+	// what the automatic screening decided about the content, only shown
+	// to moderators so spammers cannot tell which rule caught them
+	ScreeningVerdict string   `json:"-"`
+	ScreeningReasons []string `json:"-"`
+
+	// the official reply of the merchant, if any
+	Response *ReviewResponse `json:"response,omitempty"`
+	// the photos of the reviewer
+	Media []*ReviewMedia `json:"media,omitempty"`
+
+	CreatedAt time.Time `json:"-"`
+	Version   int32     `json:"version"`
+}
+
+// reviewColumns is the column list of every review query, in the order
+// scanReview reads them
+const reviewColumns = `id, product_id, rating, content, helpful_count, verified_purchase,
+	(SELECT COUNT(*) FROM review_comments c WHERE c.review_id = reviews.id AND c.status = 'approved') AS comment_count,
+	status, rejection_reason, moderated_at, edited_at, revision_count,
+	sentiment_score, COALESCE(sentiment_label, ''),
+	screening_verdict, screening_reasons, created_at, version`
+
+// attachRelated loads what is shown along with the reviews: the merchant
+// response and the photos
+func attachRelated(ctx context.Context, db *sql.DB, reviews ...*Review) error {
+	err := attachResponses(ctx, db, reviews...)
+	if err != nil {
+		return err
+	}
+	return attachMedia(ctx, db, reviews...)
+}
+
+// rowScanner is a *sql.Row or *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanReview reads the reviewColumns of a row into review, after the
+// leading columns selected before them
+func scanReview(row rowScanner, review *Review, leading ...any) error {
+	dest := append(leading,
+		&review.ID,
+		&review.ProductID,
+		&review.Rating,
+		&review.Content,
+		&review.HelpfulCount,
+		&review.VerifiedPurchase,
+		&review.CommentCount,
+		&review.Status,
+		&review.RejectionReason,
+		&review.ModeratedAt,
+		&review.EditedAt,
+		&review.RevisionCount,
+		&review.SentimentScore,
+		&review.SentimentLabel,
+		&review.ScreeningVerdict,
+		pq.Array(&review.ScreeningReasons),
+		&review.CreatedAt,
+		&review.Version,
+	)
+	return row.Scan(dest...)
 }
 
 func ValidateReview(v *validator.Validator, review *Review) {
@@ -32,18 +120,51 @@ func ValidateReview(v *validator.Validator, review *Review) {
 	v.Check(len(review.Content) <= 500, "content", "must not be more than 500 characters long")
 }
 
-func (r ReviewModel) Insert(review *Review) error {
+// ValidateRejection checks the reason a moderator gives for rejecting a
+// review
+func ValidateRejection(v *validator.Validator, reason string) {
+	v.Check(reason != "", "reason", "must be provided")
+	v.Check(len(reason) <= 500, "reason", "must not be more than 500 characters long")
+}
+
+// ValidateRatings checks the values of a rating filter
+func ValidateRatings(v *validator.Validator, key string, ratings []int64) {
+	for _, rating := range ratings {
+		v.Check(rating >= 1 && rating <= 5, key, "must only contain ratings between 1 and 5")
+	}
+}
+
+// Insert stores a review. With a proof of purchase, the review is a
+// verified purchase when the proof matches an order for the product that
+// did not verify a review yet, and that order is used up in the same
+// statement.
+func (r ReviewModel) Insert(review *Review, proof *PurchaseProof) error {
 	query := `
-		INSERT INTO reviews (product_id, rating, content, helpful_count, created_at)
-		VALUES ($1, $2, $3, $4, NOW())
-		RETURNING id, created_at, version
+		WITH redeemed AS (
+			UPDATE purchases
+			SET redeemed_at = NOW()
+			WHERE product_id = $1 AND email = $10 AND order_id = $11 AND order_id <> ''
+				AND purchased_at <= NOW() AND redeemed_at IS NULL
+			RETURNING id
+		)
+		INSERT INTO reviews (product_id, rating, content, helpful_count, verified_purchase, status,
+			sentiment_score, sentiment_label, screening_verdict, screening_reasons, created_at)
+		VALUES ($1, $2, $3, $4, EXISTS (SELECT 1 FROM redeemed), $5, $6, NULLIF($7, ''), $8, COALESCE($9::text[], '{}'), NOW())
+		RETURNING id, created_at, version, verified_purchase
 	`
-	args := []any{review.ProductID, review.Rating, review.Content, review.HelpfulCount}
+	var email, orderID string
+	if proof != nil {
+		email, orderID = NormalizeEmail(proof.Email), proof.OrderID
+	}
+	args := []any{review.ProductID, review.Rating, review.Content, review.HelpfulCount, review.Status,
+		review.SentimentScore, review.SentimentLabel, review.ScreeningVerdict, pq.Array(review.ScreeningReasons),
+		email, orderID}
 
 	return r.DB.QueryRow(query, args...).Scan(
 		&review.ID,
 		&review.CreatedAt,
 		&review.Version,
+		&review.VerifiedPurchase,
 	)
 
 }
@@ -56,7 +177,7 @@ func (r ReviewModel) Get(productID, reviewID int64) (*Review, error) {
 	}
 
 	query := `
-		SELECT id, product_id, rating, content, helpful_count, created_at, version
+		SELECT ` + reviewColumns + `
 		FROM reviews
 		WHERE product_id = $1 AND id = $2
 	`
@@ -66,15 +187,42 @@ func (r ReviewModel) Get(productID, reviewID int64) (*Review, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := r.DB.QueryRowContext(ctx, query, productID, reviewID).Scan(
-		&review.ID,
-		&review.ProductID,
-		&review.Rating,
-		&review.Content,
-		&review.HelpfulCount,
-		&review.CreatedAt,
-		&review.Version,
-	)
+	err := scanReview(r.DB.QueryRowContext(ctx, query, productID, reviewID), &review)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	err = attachRelated(ctx, r.DB, &review)
+	if err != nil {
+		return nil, err
+	}
+
+	return &review, nil
+}
+
+// GetByID fetches a review whatever its product and status, for the
+// moderators
+func (r ReviewModel) GetByID(reviewID int64) (*Review, error) {
+
+	if reviewID < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT ` + reviewColumns + `
+		FROM reviews
+		WHERE id = $1
+	`
+
+	var review Review
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := scanReview(r.DB.QueryRowContext(ctx, query, reviewID), &review)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrRecordNotFound
@@ -82,27 +230,110 @@ func (r ReviewModel) Get(productID, reviewID int64) (*Review, error) {
 		return nil, err
 	}
 
+	err = attachRelated(ctx, r.DB, &review)
+	if err != nil {
+		return nil, err
+	}
+
 	return &review, nil
 }
 
+// Update saves the review. When its rating or content changed, the
+// previous version is kept as a revision first.
 func (r ReviewModel) Update(review *Review) error {
 
 	query := `
+		WITH previous AS (
+			SELECT id, rating, content, status, COALESCE(edited_at, created_at) AS written_at, revision_count
+			FROM reviews
+			WHERE id = $7 AND product_id = $8 AND version = $11
+			FOR UPDATE
+		), revision AS (
+			INSERT INTO review_revisions (review_id, revision, rating, content, status, created_at)
+			SELECT id, revision_count + 1, rating, content, status, written_at
+			FROM previous
+			WHERE rating <> $1 OR content <> $2
+			RETURNING review_id
+		)
 		UPDATE reviews
-		SET rating = $1, content = $2, version = version + 1
-		WHERE id = $3 AND product_id = $4
-		RETURNING version
+		SET rating = $1, content = $2, status = $3, rejection_reason = $4,
+			screening_verdict = $5, screening_reasons = COALESCE($6::text[], '{}'),
+			sentiment_score = $9, sentiment_label = NULLIF($10, ''),
+			edited_at = CASE WHEN EXISTS (SELECT 1 FROM revision) THEN NOW() ELSE edited_at END,
+			revision_count = revision_count + (SELECT COUNT(*) FROM revision),
+			version = version + 1
+		WHERE id = $7 AND product_id = $8 AND version = $11
+		RETURNING edited_at, revision_count, version
 	`
 
-	args := []any{review.Rating, review.Content, review.ID, review.ProductID}
+	args := []any{review.Rating, review.Content, review.Status, review.RejectionReason,
+		review.ScreeningVerdict, pq.Array(review.ScreeningReasons), review.ID, review.ProductID,
+		review.SentimentScore, review.SentimentLabel, review.Version}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	return r.DB.QueryRowContext(ctx, query, args...).Scan(&review.Version)
+	// no row means the review changed, or was deleted, since it was read
+	err := r.DB.QueryRowContext(ctx, query, args...).Scan(&review.EditedAt, &review.RevisionCount, &review.Version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrEditConflict
+	}
+	return err
 
 }
 
+// Moderate records the decision of a moderator, the status and the
+// rejection reason of the review
+func (r ReviewModel) Moderate(review *Review) error {
+
+	query := `
+		UPDATE reviews
+		SET status = $1, rejection_reason = $2, moderated_at = NOW(), version = version + 1
+		WHERE id = $3
+		RETURNING moderated_at, version
+	`
+
+	args := []any{review.Status, review.RejectionReason, review.ID}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := r.DB.QueryRowContext(ctx, query, args...).Scan(&review.ModeratedAt, &review.Version)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Hide takes an approved review off the site until a moderator looks at
+// it. It returns false when the review was not approved.
+func (r ReviewModel) Hide(reviewID int64) (bool, error) {
+
+	query := `
+		UPDATE reviews
+		SET status = 'hidden', version = version + 1
+		WHERE id = $1 AND status = 'approved'
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := r.DB.ExecContext(ctx, query, reviewID)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected > 0, nil
+}
+
 func (r ReviewModel) Delete(productID, reviewID int64) error {
 
 	// check if the id is valid
@@ -134,20 +365,80 @@ func (r ReviewModel) Delete(productID, reviewID int64) error {
 	return nil
 }
 
-func (r ReviewModel) GetAll(rating int, content string, filters Filters) ([]*Review, Metadata, error) {
+// ReviewQuery holds the filters of a review listing. Empty fields do not
+// filter.
+type ReviewQuery struct {
+	ProductID int64   // only the reviews of this product
+	Ratings   []int64 // only these ratings
+	Content   string  // text the content contains, ignoring case
+	HasMedia  *bool   // with or without photos
+	Verified  *bool   // from verified buyers or not
+
+	Sentiments []string // only these sentiment labels
+	Mismatch   *bool    // whose sentiment contradicts the rating, or not
+}
+
+// sentimentMismatch matches the reviews whose content says the opposite
+// of their rating: a negative text with 4 or 5 stars, or a positive text
+// with 1 or 2 stars
+const sentimentMismatch = `((rating >= 4 AND sentiment_label = 'negative') OR (rating <= 2 AND sentiment_label = 'positive'))`
+
+// SentimentMismatch is sentimentMismatch for a single review
+func SentimentMismatch(rating int, label string) bool {
+	return (rating >= 4 && label == string(sentiment.Negative)) || (rating <= 2 && label == string(sentiment.Positive))
+}
+
+// conditions returns the WHERE clause of the query, which only matches
+// approved reviews, and its arguments numbered from $1
+func (q ReviewQuery) conditions() (string, []any) {
+	where := []string{"status = 'approved'"}
+	var args []any
+	add := func(condition string, arg any) {
+		args = append(args, arg)
+		where = append(where, fmt.Sprintf(condition, len(args)))
+	}
+
+	if q.ProductID > 0 {
+		add("product_id = $%d", q.ProductID)
+	}
+	if q.Ratings != nil {
+		add("rating = ANY($%d)", pq.Array(q.Ratings))
+	}
+	if q.Content != "" {
+		add("content ILIKE '%%' || $%d || '%%'", q.Content)
+	}
+	if q.HasMedia != nil {
+		add("EXISTS (SELECT 1 FROM review_media m WHERE m.review_id = reviews.id) = $%d", *q.HasMedia)
+	}
+	if q.Verified != nil {
+		add("verified_purchase = $%d", *q.Verified)
+	}
+	if q.Sentiments != nil {
+		add("sentiment_label = ANY($%d)", pq.Array(q.Sentiments))
+	}
+	if q.Mismatch != nil {
+		add("COALESCE("+sentimentMismatch+", false) = $%d", *q.Mismatch)
+	}
+
+	return strings.Join(where, " AND "), args
+}
+
+// GetAll returns a page of the approved reviews matching the query
+func (r ReviewModel) GetAll(q ReviewQuery, filters Filters) ([]*Review, Metadata, error) {
 
+	where, args := q.conditions()
 	query := fmt.Sprintf(`
-		SELECT COUNT(*) OVER(), id, product_id, rating, content, helpful_count, created_at, version
+		SELECT COUNT(*) OVER(), %s
 		FROM reviews
-		WHERE (rating = $1 OR $1 = 0)
-		AND (content ILIKE '%%' || $2 || '%%' OR $2 = '')
-		ORDER BY %s %s, id ASC
-		LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+		WHERE %s
+		ORDER BY %s
+		LIMIT $%d OFFSET $%d`, reviewColumns, where, filters.orderBy(), len(args)+1, len(args)+2)
+	args = append(args, filters.limit(), filters.offset())
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	rows, err := r.DB.QueryContext(ctx, query, rating, content, filters.limit(), filters.offset())
+	rows, err := r.DB.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, Metadata{}, err
 	}
@@ -158,16 +449,7 @@ func (r ReviewModel) GetAll(rating int, content string, filters Filters) ([]*Rev
 
 	for rows.Next() {
 		var review Review
-		err := rows.Scan(
-			&totalRecords,
-			&review.ID,
-			&review.ProductID,
-			&review.Rating,
-			&review.Content,
-			&review.HelpfulCount,
-			&review.CreatedAt,
-			&review.Version,
-		)
+		err := scanReview(rows, &review, &totalRecords)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
@@ -178,57 +460,75 @@ func (r ReviewModel) GetAll(rating int, content string, filters Filters) ([]*Rev
 		return nil, Metadata{}, err
 	}
 
+	err = attachRelated(ctx, r.DB, reviews...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	totalRecords, err = pageTotal(ctx, r.DB, totalRecords, filters, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
 	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
 	return reviews, metadata, nil
 }
 
-func (r ReviewModel) GetAllForProduct(productID int64, rating int, content string, filters Filters) ([]*Review, Metadata, error) {
+// GetAllForProduct returns a page of the approved reviews of a product
+func (r ReviewModel) GetAllForProduct(productID int64, q ReviewQuery, filters Filters) ([]*Review, Metadata, error) {
+	q.ProductID = productID
+	return r.GetAll(q, filters)
+}
 
-	query := fmt.Sprintf(`
-		SELECT COUNT(*) OVER(), id, product_id, rating, content, helpful_count, created_at, version
+// GetByIDs fetches the approved reviews with the given ids in the order
+// they were requested, along with the ids that do not exist
+func (r ReviewModel) GetByIDs(ids []int64) ([]*Review, []int64, error) {
+	query := `
+		SELECT ` + reviewColumns + `
 		FROM reviews
-		WHERE product_id = $1
-		AND (rating = $2 OR $2 = 0)
-		AND (content ILIKE '%%' || $3 || '%%' OR $3 = '')
-		ORDER BY %s %s, id ASC
-		LIMIT $4 OFFSET $5`, filters.sortColumn(), filters.sortDirection())
+		WHERE id = ANY($1) AND status = 'approved'
+	`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	rows, err := r.DB.QueryContext(ctx, query, productID, rating, content, filters.limit(), filters.offset())
+	rows, err := r.DB.QueryContext(ctx, query, pq.Array(ids))
 	if err != nil {
-		return nil, Metadata{}, err
+		return nil, nil, err
 	}
 	defer rows.Close()
 
-	var reviews []*Review
-	totalRecords := 0
-
+	found := make(map[int64]*Review, len(ids))
 	for rows.Next() {
 		var review Review
-		err := rows.Scan(
-			&totalRecords,
-			&review.ID,
-			&review.ProductID,
-			&review.Rating,
-			&review.Content,
-			&review.HelpfulCount,
-			&review.CreatedAt,
-			&review.Version,
-		)
+		err := scanReview(rows, &review)
 		if err != nil {
-			return nil, Metadata{}, err
+			return nil, nil, err
 		}
-		reviews = append(reviews, &review)
+		found[review.ID] = &review
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, Metadata{}, err
+		return nil, nil, err
 	}
 
-	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
-	return reviews, metadata, nil
+	reviews := []*Review{}
+	missing := []int64{}
+	for _, id := range ids {
+		review, ok := found[id]
+		if !ok {
+			missing = append(missing, id)
+			continue
+		}
+		reviews = append(reviews, review)
+	}
+
+	err = attachRelated(ctx, r.DB, reviews...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return reviews, missing, nil
 }
 
 func (r ReviewModel) IncrementHelpfulCount(productID, reviewID int64) error {
@@ -236,7 +536,7 @@ func (r ReviewModel) IncrementHelpfulCount(productID, reviewID int64) error {
 	query := `
 		UPDATE reviews
 		SET helpful_count = helpful_count + 1
-		WHERE product_id = $1 AND id = $2
+		WHERE product_id = $1 AND id = $2 AND status = 'approved'
 		RETURNING helpful_count
 	`
 
@@ -258,3 +558,54 @@ func (r ReviewModel) IncrementHelpfulCount(productID, reviewID int64) error {
 
 	return nil
 }
+
+// GetAllByStatus returns a page of the reviews with the given status,
+// the moderation queue when the status is pending
+func (r ReviewModel) GetAllByStatus(status string, filters Filters) ([]*Review, Metadata, error) {
+
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), %s
+		FROM reviews
+		WHERE status = $1
+		ORDER BY %s
+		LIMIT $2 OFFSET $3`, reviewColumns, filters.orderBy())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []any{status, filters.limit(), filters.offset()}
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	var reviews []*Review
+	totalRecords := 0
+
+	for rows.Next() {
+		var review Review
+		err := scanReview(rows, &review, &totalRecords)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		reviews = append(reviews, &review)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	err = attachRelated(ctx, r.DB, reviews...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	totalRecords, err = pageTotal(ctx, r.DB, totalRecords, filters, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
+	return reviews, metadata, nil
+}
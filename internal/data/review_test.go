@@ -0,0 +1,130 @@
+package data
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/georgie5/productReview/internal/validator"
+)
+
+func TestValidateReview(t *testing.T) {
+	tests := []struct {
+		name    string
+		review  Review
+		invalid []string // the keys with an error
+	}{
+		{name: "valid", review: Review{Rating: 5, Content: "Great"}},
+		{name: "rating too low", review: Review{Rating: 0, Content: "Great"}, invalid: []string{"rating"}},
+		{name: "rating too high", review: Review{Rating: 6, Content: "Great"}, invalid: []string{"rating"}},
+		{name: "no content", review: Review{Rating: 3}, invalid: []string{"content"}},
+		{name: "longest content", review: Review{Rating: 3, Content: strings.Repeat("a", 500)}},
+		{name: "content too long", review: Review{Rating: 3, Content: strings.Repeat("a", 501)}, invalid: []string{"content"}},
+	}
+
+	for _, tt := range tests {
+		v := validator.New()
+		ValidateReview(v, &tt.review)
+		checkErrors(t, tt.name, v, tt.invalid)
+	}
+}
+
+func TestValidateRejection(t *testing.T) {
+	tests := []struct {
+		reason string
+		valid  bool
+	}{
+		{"Off topic", true},
+		{"", false},
+		{strings.Repeat("a", 500), true},
+		{strings.Repeat("a", 501), false},
+	}
+
+	for _, tt := range tests {
+		v := validator.New()
+		ValidateRejection(v, tt.reason)
+		if v.IsEmpty() != tt.valid {
+			t.Errorf("ValidateRejection(%.20q) errors = %v, want valid %t", tt.reason, v.Errors, tt.valid)
+		}
+	}
+}
+
+func TestReviewQueryConditions(t *testing.T) {
+	yes := true
+
+	tests := []struct {
+		name      string
+		query     ReviewQuery
+		wantWhere string
+		wantArgs  int
+	}{
+		{name: "no filter", wantWhere: "status = 'approved'"},
+		{name: "product", query: ReviewQuery{ProductID: 7}, wantWhere: "status = 'approved' AND product_id = $1", wantArgs: 1},
+		{
+			name:      "ratings and content",
+			query:     ReviewQuery{Ratings: []int64{4, 5}, Content: "battery"},
+			wantWhere: "status = 'approved' AND rating = ANY($1) AND content ILIKE '%' || $2 || '%'",
+			wantArgs:  2,
+		},
+		{
+			name:      "verified with media",
+			query:     ReviewQuery{ProductID: 7, HasMedia: &yes, Verified: &yes},
+			wantWhere: "status = 'approved' AND product_id = $1 AND EXISTS (SELECT 1 FROM review_media m WHERE m.review_id = reviews.id) = $2 AND verified_purchase = $3",
+			wantArgs:  3,
+		},
+		{
+			name:      "sentiment mismatch",
+			query:     ReviewQuery{Sentiments: []string{"negative"}, Mismatch: &yes},
+			wantWhere: "status = 'approved' AND sentiment_label = ANY($1) AND COALESCE(" + sentimentMismatch + ", false) = $2",
+			wantArgs:  2,
+		},
+	}
+
+	for _, tt := range tests {
+		where, args := tt.query.conditions()
+		if where != tt.wantWhere {
+			t.Errorf("%s: where = %q, want %q", tt.name, where, tt.wantWhere)
+		}
+		if len(args) != tt.wantArgs {
+			t.Errorf("%s: got %d arguments, want %d", tt.name, len(args), tt.wantArgs)
+		}
+	}
+}
+
+func TestSentimentMismatch(t *testing.T) {
+	tests := []struct {
+		rating int
+		label  string
+		want   bool
+	}{
+		{5, "negative", true},
+		{4, "negative", true},
+		{3, "negative", false},
+		{5, "positive", false},
+		{2, "positive", true},
+		{1, "positive", true},
+		{1, "neutral", false},
+		{1, "", false}, // not scored yet
+	}
+
+	for _, tt := range tests {
+		if got := SentimentMismatch(tt.rating, tt.label); got != tt.want {
+			t.Errorf("SentimentMismatch(%d, %q) = %t, want %t", tt.rating, tt.label, got, tt.want)
+		}
+	}
+}
+
+// checkErrors reports when the validator does not have errors for exactly
+// the given keys
+func checkErrors(t *testing.T, name string, v *validator.Validator, keys []string) {
+	t.Helper()
+
+	if len(v.Errors) != len(keys) {
+		t.Errorf("%s: errors = %v, want errors for %v", name, v.Errors, keys)
+		return
+	}
+	for _, key := range keys {
+		if _, ok := v.Errors[key]; !ok {
+			t.Errorf("%s: errors = %v, want an error for %q", name, v.Errors, key)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/georgie5/productReview/internal/textdiff"
+)
+
+// RevisionModel wraps the database connection pool
+type RevisionModel struct {
+	DB *sql.DB
+}
+
+// ReviewRevision is an earlier version of a review, kept when its rating
+// or content was edited. The versions of a review are numbered from 1.
+type ReviewRevision struct {
+	ReviewID   int64     `json:"review_id"`
+	Revision   int       `json:"revision"`
+	Rating     int       `json:"rating"`
+	Content    string    `json:"content"`
+	Status     string    `json:"status,omitempty"` // of the review when it was replaced, unknown for old revisions
+	CreatedAt  time.Time `json:"created_at"`       // when this version was written
+	ReplacedAt time.Time `json:"replaced_at"`      // when the next version replaced it
+}
+
+// Published tells whether this version was approved when it was
+// replaced, so readers saw it as it stands
+func (r *ReviewRevision) Published() bool {
+	return r.Status == ReviewStatusApproved
+}
+
+// GetForReview returns the earlier versions of a review, oldest first
+func (m RevisionModel) GetForReview(reviewID int64) ([]*ReviewRevision, error) {
+	query := `
+		SELECT review_id, revision, rating, content, COALESCE(status, ''), created_at, replaced_at
+		FROM review_revisions
+		WHERE review_id = $1
+		ORDER BY revision
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, reviewID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []*ReviewRevision{}
+	for rows.Next() {
+		var revision ReviewRevision
+		err := rows.Scan(
+			&revision.ReviewID,
+			&revision.Revision,
+			&revision.Rating,
+			&revision.Content,
+			&revision.Status,
+			&revision.CreatedAt,
+			&revision.ReplacedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, &revision)
+	}
+
+	return revisions, rows.Err()
+}
+
+// ReviewVersion is a version of a review in its edit history, with what
+// changed since the version before it
+type ReviewVersion struct {
+	Revision  int           `json:"revision"`
+	Rating    int           `json:"rating"`
+	Content   string        `json:"content"`
+	Status    string        `json:"status,omitempty"` // of the review while it was this version
+	CreatedAt time.Time     `json:"created_at"`
+	Current   bool          `json:"current"`
+	Changes   *ReviewChange `json:"changes,omitempty"` // missing for the first version
+}
+
+// ReviewChange is the difference between two versions of a review
+type ReviewChange struct {
+	Rating  *RatingChange `json:"rating,omitempty"`
+	Content []textdiff.Op `json:"content,omitempty"` // word by word, missing when unchanged
+}
+
+// RatingChange is a change of rating
+type RatingChange struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+// History returns every version of a review, the earlier versions then
+// the current one, each with the changes made to the version before it
+func History(review *Review, revisions []*ReviewRevision) []*ReviewVersion {
+	versions := make([]*ReviewVersion, 0, len(revisions)+1)
+	for _, revision := range revisions {
+		versions = append(versions, &ReviewVersion{
+			Revision:  revision.Revision,
+			Rating:    revision.Rating,
+			Content:   revision.Content,
+			Status:    revision.Status,
+			CreatedAt: revision.CreatedAt,
+		})
+	}
+
+	current := &ReviewVersion{
+		Revision:  review.RevisionCount + 1,
+		Rating:    review.Rating,
+		Content:   review.Content,
+		Status:    review.Status,
+		CreatedAt: review.CreatedAt,
+		Current:   true,
+	}
+	if review.EditedAt != nil {
+		current.CreatedAt = *review.EditedAt
+	}
+	versions = append(versions, current)
+
+	for i := 1; i < len(versions); i++ {
+		previous, version := versions[i-1], versions[i]
+		change := &ReviewChange{}
+		if previous.Rating != version.Rating {
+			change.Rating = &RatingChange{From: previous.Rating, To: version.Rating}
+		}
+		if previous.Content != version.Content {
+			change.Content = textdiff.Words(previous.Content, version.Content)
+		}
+		version.Changes = change
+	}
+
+	return versions
+}
@@ -0,0 +1,46 @@
+package data
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHistory(t *testing.T) {
+	created := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	edited := created.Add(48 * time.Hour)
+
+	review := &Review{Rating: 2, Content: "It broke", Status: ReviewStatusApproved, CreatedAt: created, EditedAt: &edited, RevisionCount: 2}
+	revisions := []*ReviewRevision{
+		{Revision: 1, Rating: 5, Content: "It works", Status: ReviewStatusApproved, CreatedAt: created},
+		{Revision: 2, Rating: 2, Content: "It works", Status: ReviewStatusPending, CreatedAt: created.Add(24 * time.Hour)},
+	}
+
+	versions := History(review, revisions)
+	if len(versions) != 3 {
+		t.Fatalf("got %d versions, want 3", len(versions))
+	}
+
+	first, second, current := versions[0], versions[1], versions[2]
+	if first.Changes != nil || first.Current {
+		t.Errorf("first version = %+v, want no changes and not current", first)
+	}
+	if second.Changes == nil || second.Changes.Rating == nil || *second.Changes.Rating != (RatingChange{From: 5, To: 2}) || second.Changes.Content != nil {
+		t.Errorf("second version changes = %+v, want only the rating from 5 to 2", second.Changes)
+	}
+	if second.Status != ReviewStatusPending {
+		t.Errorf("second version status = %q, want pending", second.Status)
+	}
+	if !current.Current || current.Revision != 3 || !current.CreatedAt.Equal(edited) {
+		t.Errorf("current version = %+v, want revision 3 written when edited", current)
+	}
+	if current.Changes == nil || current.Changes.Rating != nil || len(current.Changes.Content) == 0 {
+		t.Errorf("current version changes = %+v, want only the content", current.Changes)
+	}
+
+	// a review never edited has a single version
+	review = &Review{Rating: 4, Content: "Fine", CreatedAt: created}
+	versions = History(review, nil)
+	if len(versions) != 1 || !versions[0].Current || versions[0].Revision != 1 || versions[0].Changes != nil {
+		t.Errorf("History without revisions = %+v, want the current version alone", versions[0])
+	}
+}
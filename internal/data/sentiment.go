@@ -0,0 +1,164 @@
+package data
+
+import (
+	"context"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/georgie5/productReview/internal/sentiment"
+	"github.com/georgie5/productReview/internal/validator"
+	"github.com/lib/pq"
+)
+
+// SentimentBreakdown sums up the sentiment of the published reviews of a
+// product
+type SentimentBreakdown struct {
+	ProductID    int64                  `json:"product_id"`
+	Total        int                    `json:"total"`
+	Scored       int                    `json:"scored"`        // the reviews scored so far
+	AverageScore float64                `json:"average_score"` // of the scored reviews
+	Labels       map[string]int         `json:"labels"`
+	Ratings      map[int]map[string]int `json:"ratings"`    // the labels of each rating
+	Mismatches   int                    `json:"mismatches"` // reviews whose sentiment contradicts the rating
+}
+
+// unscored stands for the reviews without a sentiment label in a
+// breakdown
+const unscored = "unscored"
+
+// SentimentBreakdown returns the sentiment breakdown of the approved
+// reviews of a product
+func (r ReviewModel) SentimentBreakdown(productID int64) (*SentimentBreakdown, error) {
+	query := `
+		SELECT rating, COALESCE(sentiment_label, ''), COUNT(*), COALESCE(SUM(sentiment_score), 0)
+		FROM reviews
+		WHERE product_id = $1 AND status = 'approved'
+		GROUP BY rating, sentiment_label
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := r.DB.QueryContext(ctx, query, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	breakdown := &SentimentBreakdown{
+		ProductID: productID,
+		Labels:    make(map[string]int),
+		Ratings:   make(map[int]map[string]int),
+	}
+	// every label and rating shows up, even without reviews
+	for _, label := range sentiment.Labels {
+		breakdown.Labels[string(label)] = 0
+	}
+	for rating := 1; rating <= 5; rating++ {
+		breakdown.Ratings[rating] = make(map[string]int)
+		for _, label := range sentiment.Labels {
+			breakdown.Ratings[rating][string(label)] = 0
+		}
+	}
+
+	sum := 0.0
+	for rows.Next() {
+		var (
+			rating int
+			label  string
+			count  int
+			score  float64
+		)
+		if err := rows.Scan(&rating, &label, &count, &score); err != nil {
+			return nil, err
+		}
+
+		breakdown.Total += count
+		if label == "" {
+			label = unscored
+		} else {
+			breakdown.Scored += count
+			sum += score
+		}
+		breakdown.Labels[label] += count
+		if breakdown.Ratings[rating] == nil {
+			breakdown.Ratings[rating] = make(map[string]int)
+		}
+		breakdown.Ratings[rating][label] += count
+		if SentimentMismatch(rating, label) {
+			breakdown.Mismatches += count
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if breakdown.Scored > 0 {
+		breakdown.AverageScore = math.Round(sum/float64(breakdown.Scored)*1000) / 1000
+	}
+	return breakdown, nil
+}
+
+// ValidateSentiments checks the values of a sentiment filter
+func ValidateSentiments(v *validator.Validator, key string, labels []string) {
+	for _, label := range labels {
+		v.Check(slices.Contains(sentiment.Labels, sentiment.Label(label)), key, "must only contain positive, neutral or negative")
+	}
+}
+
+// ReviewText is the content of a review to score
+type ReviewText struct {
+	ID      int64
+	Content string
+}
+
+// GetForScoring returns up to limit reviews after the given id, by id,
+// only the ones never scored unless all is set
+func (r ReviewModel) GetForScoring(afterID int64, all bool, limit int) ([]ReviewText, error) {
+	query := `
+		SELECT id, content
+		FROM reviews
+		WHERE id > $1 AND ($2::boolean OR sentiment_label IS NULL)
+		ORDER BY id
+		LIMIT $3
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rows, err := r.DB.QueryContext(ctx, query, afterID, all, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reviews []ReviewText
+	for rows.Next() {
+		var review ReviewText
+		if err := rows.Scan(&review.ID, &review.Content); err != nil {
+			return nil, err
+		}
+		reviews = append(reviews, review)
+	}
+
+	return reviews, rows.Err()
+}
+
+// SetSentiments stores the scores and labels of a batch of reviews, in
+// the order of their ids. It leaves the version alone since the review
+// itself did not change.
+func (r ReviewModel) SetSentiments(ids []int64, scores []float64, labels []string) error {
+	query := `
+		UPDATE reviews
+		SET sentiment_score = s.score, sentiment_label = s.label
+		FROM unnest($1::bigint[], $2::double precision[], $3::text[]) AS s(id, score, label)
+		WHERE reviews.id = s.id
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := r.DB.ExecContext(ctx, query, pq.Array(ids), pq.Array(scores), pq.Array(labels))
+	return err
+}
@@ -0,0 +1,71 @@
+package media
+
+import "encoding/binary"
+
+// maxGIFFrames is the most frames a GIF animation can have
+const maxGIFFrames = 500
+
+// gifFrames counts the frames of a GIF file and the pixels they add up
+// to, reading only the block headers so nothing is decoded yet. It
+// returns false when the file ends in the middle of a block.
+func gifFrames(data []byte) (frames int, pixels int64, ok bool) {
+	// header and logical screen descriptor
+	if len(data) < 13 {
+		return 0, 0, false
+	}
+	i := 13
+	if flags := data[10]; flags&0x80 != 0 { // global color table
+		i += 3 << (flags&0x07 + 1)
+	}
+
+	for i < len(data) {
+		switch data[i] {
+		case 0x21: // extension: a label, then data sub-blocks
+			if i+2 > len(data) {
+				return 0, 0, false
+			}
+			i, ok = skipSubBlocks(data, i+2)
+			if !ok {
+				return 0, 0, false
+			}
+		case 0x2C: // image descriptor
+			if i+10 > len(data) {
+				return 0, 0, false
+			}
+			width := int64(binary.LittleEndian.Uint16(data[i+5:]))
+			height := int64(binary.LittleEndian.Uint16(data[i+7:]))
+			frames++
+			pixels += width * height
+
+			flags := data[i+9]
+			i += 10
+			if flags&0x80 != 0 { // local color table
+				i += 3 << (flags&0x07 + 1)
+			}
+			// the LZW minimum code size, then the image data sub-blocks
+			i, ok = skipSubBlocks(data, i+1)
+			if !ok {
+				return 0, 0, false
+			}
+		case 0x3B: // trailer
+			return frames, pixels, true
+		default:
+			return 0, 0, false
+		}
+	}
+	return 0, 0, false
+}
+
+// skipSubBlocks returns the position after the data sub-blocks starting
+// at i, which end with a block of size 0
+func skipSubBlocks(data []byte, i int) (int, bool) {
+	for i < len(data) {
+		size := int(data[i])
+		i++
+		if size == 0 {
+			return i, true
+		}
+		i += size
+	}
+	return 0, false
+}
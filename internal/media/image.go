@@ -0,0 +1,228 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+var (
+	// ErrUnsupportedType is returned for files that are not JPEG, PNG or
+	// GIF images
+	ErrUnsupportedType = errors.New("must be a JPEG, PNG or GIF image")
+	// ErrInvalidImage is returned for images that cannot be decoded
+	ErrInvalidImage = errors.New("is not a valid image")
+	// ErrDimensions is returned for images larger than the limits
+	ErrDimensions = errors.New("is too large")
+)
+
+// The content types accepted, by the format name of the image package
+var contentTypes = map[string]string{
+	"jpeg": "image/jpeg",
+	"png":  "image/png",
+	"gif":  "image/gif",
+}
+
+// Limits are the largest images accepted
+type Limits struct {
+	MaxWidth  int
+	MaxHeight int
+}
+
+// Image is an uploaded image, decoded and encoded again so the metadata
+// of the original file (EXIF, comments, color profiles) is left out
+type Image struct {
+	Format      string // jpeg, png or gif
+	ContentType string
+	Width       int
+	Height      int
+	Data        []byte
+
+	decoded image.Image // the first frame of a GIF
+}
+
+// Ext returns the file extension of the image format
+func (img *Image) Ext() string {
+	if img.Format == "jpeg" {
+		return ".jpg"
+	}
+	return "." + img.Format
+}
+
+// Decode checks that data is an image within the limits and encodes it
+// again. JPEG photos are turned upright following their EXIF orientation
+// first, as the orientation is lost with the rest of the metadata.
+func Decode(data []byte, limits Limits) (*Image, error) {
+
+	// trust the bytes, not the name or content type the client gave
+	contentType := http.DetectContentType(data)
+	format := ""
+	for f, ct := range contentTypes {
+		if ct == contentType {
+			format = f
+		}
+	}
+	if format == "" {
+		return nil, ErrUnsupportedType
+	}
+
+	// check the dimensions before decoding, which allocates the pixels
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+	if config.Width > limits.MaxWidth || config.Height > limits.MaxHeight {
+		return nil, fmt.Errorf("%w: %dx%d pixels, the limit is %dx%d", ErrDimensions,
+			config.Width, config.Height, limits.MaxWidth, limits.MaxHeight)
+	}
+
+	img := &Image{Format: format, ContentType: contentType}
+	var buf bytes.Buffer
+
+	switch format {
+	case "jpeg":
+		decoded, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, ErrInvalidImage
+		}
+		img.decoded = orient(decoded, jpegOrientation(data))
+		err = jpeg.Encode(&buf, img.decoded, &jpeg.Options{Quality: 90})
+		if err != nil {
+			return nil, err
+		}
+	case "png":
+		decoded, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, ErrInvalidImage
+		}
+		img.decoded = decoded
+		err = png.Encode(&buf, decoded)
+		if err != nil {
+			return nil, err
+		}
+	case "gif":
+		// every frame is decoded, so the frames count against the
+		// limits as much as the size of one frame does
+		frames, pixels, ok := gifFrames(data)
+		if !ok {
+			return nil, ErrInvalidImage
+		}
+		maxPixels := int64(limits.MaxWidth) * int64(limits.MaxHeight)
+		if frames > maxGIFFrames || pixels > maxPixels {
+			return nil, fmt.Errorf("%w: %d frames of %d pixels in all, the limit is %d frames and %d pixels", ErrDimensions,
+				frames, pixels, maxGIFFrames, maxPixels)
+		}
+
+		// keep the animation, the encoder writes no comments or
+		// application data besides the loop count
+		decoded, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil || len(decoded.Image) == 0 {
+			return nil, ErrInvalidImage
+		}
+		img.decoded = decoded.Image[0]
+		err = gif.EncodeAll(&buf, &gif.GIF{
+			Image:     decoded.Image,
+			Delay:     decoded.Delay,
+			LoopCount: decoded.LoopCount,
+			Disposal:  decoded.Disposal,
+			Config:    decoded.Config,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	img.Data = buf.Bytes()
+	img.Width = img.decoded.Bounds().Dx()
+	img.Height = img.decoded.Bounds().Dy()
+	return img, nil
+}
+
+// Resize returns the image scaled down to fit in a size x size square,
+// or the image itself when it is smaller. JPEG stays JPEG, other formats
+// become PNG, which keeps the transparency.
+func (img *Image) Resize(size int) (*Image, error) {
+	if img.Width <= size && img.Height <= size {
+		return img, nil
+	}
+
+	width, height := size, img.Height*size/img.Width
+	if img.Height > img.Width {
+		width, height = img.Width*size/img.Height, size
+	}
+	resized := scale(img.decoded, max(width, 1), max(height, 1))
+
+	result := &Image{
+		Format:      "png",
+		ContentType: contentTypes["png"],
+		Width:       resized.Bounds().Dx(),
+		Height:      resized.Bounds().Dy(),
+		decoded:     resized,
+	}
+
+	var buf bytes.Buffer
+	var err error
+	if img.Format == "jpeg" {
+		result.Format = "jpeg"
+		result.ContentType = contentTypes["jpeg"]
+		err = jpeg.Encode(&buf, resized, &jpeg.Options{Quality: 85})
+	} else {
+		err = png.Encode(&buf, resized)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result.Data = buf.Bytes()
+	return result, nil
+}
+
+// toRGBA copies any image into an RGBA image starting at 0,0
+func toRGBA(src image.Image) *image.RGBA {
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), src, b.Min, draw.Src)
+	return dst
+}
+
+// scale resizes with a box filter: every pixel of the result is the
+// average of the pixels of the source it covers
+func scale(src image.Image, width, height int) *image.RGBA {
+	rgba := toRGBA(src)
+	sw, sh := rgba.Rect.Dx(), rgba.Rect.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		y0, y1 := y*sh/height, (y+1)*sh/height
+		y1 = max(y1, y0+1)
+		for x := 0; x < width; x++ {
+			x0, x1 := x*sw/width, (x+1)*sw/width
+			x1 = max(x1, x0+1)
+
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				row := rgba.Pix[sy*rgba.Stride+x0*4 : sy*rgba.Stride+x1*4]
+				for i := 0; i < len(row); i += 4 {
+					sum[0] += int(row[i])
+					sum[1] += int(row[i+1])
+					sum[2] += int(row[i+2])
+					sum[3] += int(row[i+3])
+				}
+			}
+
+			n := (y1 - y0) * (x1 - x0)
+			offset := y*dst.Stride + x*4
+			for c := 0; c < 4; c++ {
+				dst.Pix[offset+c] = uint8(sum[c] / n)
+			}
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,117 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"testing"
+)
+
+// testGIF encodes an animation of frames frames of width x height pixels
+func testGIF(t *testing.T, frames, width, height int) []byte {
+	t.Helper()
+
+	palette := color.Palette{color.Black, color.White}
+	animation := &gif.GIF{}
+	for i := 0; i < frames; i++ {
+		animation.Image = append(animation.Image, image.NewPaletted(image.Rect(0, 0, width, height), palette))
+		animation.Delay = append(animation.Delay, 10)
+	}
+
+	var buf bytes.Buffer
+	err := gif.EncodeAll(&buf, animation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func testPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestGIFFrames(t *testing.T) {
+	frames, pixels, ok := gifFrames(testGIF(t, 3, 20, 10))
+	if !ok || frames != 3 || pixels != 600 {
+		t.Errorf("gifFrames = %d, %d, %t, want 3, 600, true", frames, pixels, ok)
+	}
+
+	data := testGIF(t, 3, 20, 10)
+	for _, truncated := range [][]byte{data[:10], data[:len(data)-1], data[:len(data)/2]} {
+		if _, _, ok := gifFrames(truncated); ok {
+			t.Errorf("gifFrames of %d of %d bytes succeeded, want false", len(truncated), len(data))
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	limits := Limits{MaxWidth: 100, MaxHeight: 100}
+
+	tests := []struct {
+		name       string
+		data       []byte
+		wantErr    error
+		wantFormat string
+	}{
+		{name: "png", data: testPNG(t, 50, 40), wantFormat: "png"},
+		{name: "png too wide", data: testPNG(t, 101, 40), wantErr: ErrDimensions},
+		{name: "animation", data: testGIF(t, 4, 50, 50), wantFormat: "gif"},
+		{name: "too many frames", data: testGIF(t, maxGIFFrames+1, 1, 1), wantErr: ErrDimensions},
+		{name: "too many pixels in all", data: testGIF(t, 5, 100, 100), wantErr: ErrDimensions},
+		{name: "truncated gif", data: testGIF(t, 2, 10, 10)[:40], wantErr: ErrInvalidImage},
+		{name: "text", data: []byte("hello, world"), wantErr: ErrUnsupportedType},
+	}
+
+	for _, tt := range tests {
+		img, err := Decode(tt.data, limits)
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("%s: error = %v, want %v", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+			continue
+		}
+		if img.Format != tt.wantFormat {
+			t.Errorf("%s: format = %q, want %q", tt.name, img.Format, tt.wantFormat)
+		}
+	}
+}
+
+func TestResize(t *testing.T) {
+	img, err := Decode(testPNG(t, 80, 40), Limits{MaxWidth: 100, MaxHeight: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		size                  int
+		wantWidth, wantHeight int
+	}{
+		{100, 80, 40}, // already small enough
+		{40, 40, 20},
+		{1, 1, 1},
+	}
+
+	for _, tt := range tests {
+		resized, err := img.Resize(tt.size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resized.Width != tt.wantWidth || resized.Height != tt.wantHeight {
+			t.Errorf("Resize(%d) = %dx%d, want %dx%d", tt.size, resized.Width, resized.Height, tt.wantWidth, tt.wantHeight)
+		}
+	}
+}
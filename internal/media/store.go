@@ -0,0 +1,141 @@
+package media
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNotFound is returned for a key that holds no file
+var ErrNotFound = errors.New("media not found")
+
+// ErrInvalidKey is returned for a key that could escape the store, such
+// as one containing ".."
+var ErrInvalidKey = errors.New("invalid media key")
+
+// BlobStore keeps uploaded files under slash separated keys such as
+// "reviews/7/3f9a.jpg"
+type BlobStore interface {
+	Put(ctx context.Context, key string, r io.Reader) error
+	// Get returns the file, which is also an io.ReadSeeker when the store
+	// supports it
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// LocalStore is a BlobStore keeping the files in a directory
+type LocalStore struct {
+	Root string
+}
+
+// path returns the file of a key, making sure it stays under the root
+func (s LocalStore) path(key string) (string, error) {
+	clean := path.Clean("/" + key)
+	if key == "" || clean != "/"+key || strings.Contains(key, "\\") {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(s.Root, filepath.FromSlash(clean)), nil
+}
+
+// Put writes the file to a temporary name first, so a reader never sees
+// a partial file
+func (s LocalStore) Put(ctx context.Context, key string, r io.Reader) error {
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(name), 0o755)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), name)
+}
+
+func (s LocalStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	name, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		file.Close()
+		return nil, ErrNotFound
+	}
+
+	return file, nil
+}
+
+// Delete removes a file. Deleting a missing file is not an error.
+func (s LocalStore) Delete(ctx context.Context, key string) error {
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// RandomKey returns a key made of the prefix, a random name and the
+// extension, for files that are never overwritten
+func RandomKey(prefix string, ext string) string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return path.Join(prefix, hex.EncodeToString(b)+ext)
+}
+
+// ContentHash returns the SHA-256 of a file in hex
+func ContentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// HashKey returns the key of a file stored by the hash of its content,
+// such as "products/3f/3f9a.../large.jpg". The same content always gets
+// the same key, so it is stored once however often it is uploaded.
+func HashKey(prefix string, hash string, name string, ext string) string {
+	return path.Join(prefix, hash[:2], hash, name+ext)
+}
@@ -0,0 +1,80 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestLocalStore(t *testing.T) {
+	store := LocalStore{Root: t.TempDir()}
+	ctx := context.Background()
+
+	err := store.Put(ctx, "reviews/7/photo.jpg", strings.NewReader("jpeg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := store.Get(ctx, "reviews/7/photo.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := io.ReadAll(file)
+	file.Close()
+	if err != nil || string(content) != "jpeg" {
+		t.Errorf("Get = %q, %v, want jpeg", content, err)
+	}
+
+	// a directory is not a file
+	if _, err := store.Get(ctx, "reviews/7"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of a directory error = %v, want ErrNotFound", err)
+	}
+
+	err = store.Delete(ctx, "reviews/7/photo.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(ctx, "reviews/7/photo.jpg"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete error = %v, want ErrNotFound", err)
+	}
+	if err := store.Delete(ctx, "reviews/7/photo.jpg"); err != nil {
+		t.Errorf("Delete of a missing file error = %v, want none", err)
+	}
+}
+
+func TestLocalStoreInvalidKeys(t *testing.T) {
+	store := LocalStore{Root: t.TempDir()}
+
+	for _, key := range []string{"", "../secret", "reviews/../../secret", "/etc/passwd", "reviews//photo.jpg", `reviews\photo.jpg`, "reviews/"} {
+		if err := store.Put(context.Background(), key, strings.NewReader("x")); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Put(%q) error = %v, want ErrInvalidKey", key, err)
+		}
+		if _, err := store.Get(context.Background(), key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Get(%q) error = %v, want ErrInvalidKey", key, err)
+		}
+	}
+}
+
+func TestRandomKey(t *testing.T) {
+	first, second := RandomKey("reviews/7", ".jpg"), RandomKey("reviews/7", ".jpg")
+	if first == second {
+		t.Errorf("RandomKey returned %q twice", first)
+	}
+	if !strings.HasPrefix(first, "reviews/7/") || !strings.HasSuffix(first, ".jpg") || len(first) != len("reviews/7/")+32+len(".jpg") {
+		t.Errorf("RandomKey = %q, want reviews/7/ then 32 hex digits and .jpg", first)
+	}
+}
+
+func TestHashKey(t *testing.T) {
+	hash := ContentHash([]byte("hello"))
+	if hash != "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824" {
+		t.Errorf(`ContentHash("hello") = %q, want its SHA-256`, hash)
+	}
+
+	want := "products/2c/" + hash + "/large.jpg"
+	if got := HashKey("products", hash, "large", ".jpg"); got != want {
+		t.Errorf("HashKey = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,141 @@
+package screening
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// BannedWords rejects text containing any of the words, ignoring case.
+// Only whole words match, so "class" does not match "ass".
+type BannedWords struct {
+	pattern *regexp.Regexp
+}
+
+func NewBannedWords(words []string) BannedWords {
+	var quoted []string
+	for _, word := range words {
+		word = strings.TrimSpace(word)
+		if word != "" {
+			quoted = append(quoted, regexp.QuoteMeta(word))
+		}
+	}
+	if len(quoted) == 0 {
+		return BannedWords{}
+	}
+	return BannedWords{pattern: regexp.MustCompile(`(?i)\b(` + strings.Join(quoted, "|") + `)\b`)}
+}
+
+func (b BannedWords) Screen(text string) Result {
+	if b.pattern == nil {
+		return allow()
+	}
+	found := b.pattern.FindAllString(text, -1)
+	if len(found) == 0 {
+		return allow()
+	}
+	return Result{Verdict: Reject, Reasons: []string{fmt.Sprintf("contains banned words (%d)", len(found))}}
+}
+
+// the links a spammer writes, with or without a scheme
+var linkPattern = regexp.MustCompile(`(?i)\b(https?://\S+|www\.\S+|[a-z0-9-]+\.(com|net|org|info|biz|io|ru|cn|xyz|top|shop)\b(/\S*)?)`)
+
+// Links flags text containing a link, and rejects text containing more
+// than MaxLinks of them
+type Links struct {
+	MaxLinks int
+}
+
+func (l Links) Screen(text string) Result {
+	count := len(linkPattern.FindAllString(text, -1))
+	switch {
+	case count == 0:
+		return allow()
+	case count > l.MaxLinks:
+		return Result{Verdict: Reject, Reasons: []string{fmt.Sprintf("contains too many links (%d)", count)}}
+	default:
+		return Result{Verdict: Flag, Reasons: []string{"contains a link"}}
+	}
+}
+
+// Shouting flags text written mostly in capitals, or with a character
+// repeated many times in a row ("sooooooo good!!!!!!")
+type Shouting struct {
+	MaxRepeat       int     // longest run of one character allowed
+	MaxUpperRatio   float64 // largest share of capitals among the letters
+	MinLettersUpper int     // shorter texts are never shouting
+}
+
+func (s Shouting) Screen(text string) Result {
+	var reasons []string
+
+	run, longest := 0, 0
+	var previous rune
+	letters, upper := 0, 0
+	for _, c := range text {
+		// prices and model numbers repeat digits legitimately
+		if c == previous && !unicode.IsSpace(c) && !unicode.IsDigit(c) {
+			run++
+		} else {
+			run = 1
+		}
+		previous = c
+		longest = max(longest, run)
+
+		if unicode.IsLetter(c) {
+			letters++
+			if unicode.IsUpper(c) {
+				upper++
+			}
+		}
+	}
+
+	if s.MaxRepeat > 0 && longest > s.MaxRepeat {
+		reasons = append(reasons, fmt.Sprintf("repeats a character %d times", longest))
+	}
+	if letters >= s.MinLettersUpper && letters > 0 && float64(upper)/float64(letters) > s.MaxUpperRatio {
+		reasons = append(reasons, "is written mostly in capitals")
+	}
+
+	if len(reasons) == 0 {
+		return allow()
+	}
+	return Result{Verdict: Flag, Reasons: reasons}
+}
+
+// Emoji flags text with more than MaxEmoji emoji, or made mostly of emoji
+type Emoji struct {
+	MaxEmoji int
+}
+
+func (e Emoji) Screen(text string) Result {
+	emoji, visible := 0, 0
+	for _, c := range text {
+		if unicode.IsSpace(c) {
+			continue
+		}
+		visible++
+		if isEmoji(c) {
+			emoji++
+		}
+	}
+
+	if emoji > e.MaxEmoji || (emoji > 3 && emoji*2 > visible) {
+		return Result{Verdict: Flag, Reasons: []string{fmt.Sprintf("contains too many emoji (%d)", emoji)}}
+	}
+	return allow()
+}
+
+// isEmoji reports whether c is in one of the emoji blocks
+func isEmoji(c rune) bool {
+	switch {
+	case c >= 0x1F300 && c <= 0x1FAFF: // pictographs, emoticons, transport, supplemental symbols
+		return true
+	case c >= 0x2600 && c <= 0x27BF: // miscellaneous symbols and dingbats
+		return true
+	case c >= 0x1F1E6 && c <= 0x1F1FF: // regional indicators (flags)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package screening
+
+import "strings"
+
+// Verdict is what a screener decides about a piece of text
+type Verdict string
+
+const (
+	Allow  Verdict = "allow"  // publish as usual
+	Flag   Verdict = "flag"   // hold for a moderator
+	Reject Verdict = "reject" // refuse the text
+)
+
+// severity orders the verdicts, so the strictest one wins
+func (v Verdict) severity() int {
+	switch v {
+	case Reject:
+		return 2
+	case Flag:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Result is a verdict and the reasons for it
+type Result struct {
+	Verdict Verdict
+	Reasons []string
+}
+
+// allow is the result of a screener that found nothing
+func allow() Result {
+	return Result{Verdict: Allow}
+}
+
+// ReviewScreener checks the text of a review (or of any other text
+// written by a visitor) for spam and abuse
+type ReviewScreener interface {
+	Screen(text string) Result
+}
+
+// Pipeline runs every screener and returns the strictest verdict, with
+// the reasons of every screener that did not allow the text
+type Pipeline []ReviewScreener
+
+func (p Pipeline) Screen(text string) Result {
+	result := allow()
+	for _, screener := range p {
+		r := screener.Screen(text)
+		if r.Verdict.severity() > result.Verdict.severity() {
+			result.Verdict = r.Verdict
+		}
+		if r.Verdict != Allow {
+			result.Reasons = append(result.Reasons, r.Reasons...)
+		}
+	}
+	return result
+}
+
+// Summary joins the reasons into one message
+func (r Result) Summary() string {
+	return strings.Join(r.Reasons, "; ")
+}
@@ -0,0 +1,129 @@
+package screening
+
+import "testing"
+
+func TestBannedWords(t *testing.T) {
+	screener := NewBannedWords([]string{"scam", " ", "a.b"})
+
+	tests := []struct {
+		text string
+		want Verdict
+	}{
+		{"A fine kettle", Allow},
+		{"This is a scam", Reject},
+		{"SCAM!", Reject},
+		{"Scammers everywhere", Allow}, // only whole words
+		{"a.b", Reject},
+		{"axb", Allow}, // the words are not patterns
+	}
+
+	for _, tt := range tests {
+		if got := screener.Screen(tt.text).Verdict; got != tt.want {
+			t.Errorf("Screen(%q) = %s, want %s", tt.text, got, tt.want)
+		}
+	}
+
+	if got := NewBannedWords(nil).Screen("scam").Verdict; got != Allow {
+		t.Errorf("Screen without banned words = %s, want allow", got)
+	}
+}
+
+func TestLinks(t *testing.T) {
+	screener := Links{MaxLinks: 1}
+
+	tests := []struct {
+		text string
+		want Verdict
+	}{
+		{"No links here. Really.", Allow},
+		{"See https://example.com/deal", Flag},
+		{"Visit www.example.net", Flag},
+		{"cheap-stuff.shop/kettles", Flag},
+		{"example.com and http://example.org", Reject},
+	}
+
+	for _, tt := range tests {
+		if got := screener.Screen(tt.text).Verdict; got != tt.want {
+			t.Errorf("Screen(%q) = %s, want %s", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestShouting(t *testing.T) {
+	screener := Shouting{MaxRepeat: 5, MaxUpperRatio: 0.7, MinLettersUpper: 12}
+
+	tests := []struct {
+		text string
+		want Verdict
+	}{
+		{"Works well with my USB hub", Allow},
+		{"THIS KETTLE IS BROKEN", Flag},
+		{"LOVE IT", Allow}, // too short to be shouting
+		{"sooooooo good", Flag},
+		{"soooo good", Allow},
+		{"It cost 1000000 dollars", Allow}, // digits may repeat
+	}
+
+	for _, tt := range tests {
+		if got := screener.Screen(tt.text).Verdict; got != tt.want {
+			t.Errorf("Screen(%q) = %s, want %s", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestEmoji(t *testing.T) {
+	screener := Emoji{MaxEmoji: 5}
+
+	tests := []struct {
+		text string
+		want Verdict
+	}{
+		{"Great kettle 👍", Allow},
+		{"👍👍👍", Allow},
+		{"👍 👍 👍 👍", Flag}, // mostly emoji
+		{"Great kettle, boils fast 👍👍👍👍", Allow},
+		{"Great kettle, boils fast and looks nice 😀😀😀😀😀😀", Flag},
+	}
+
+	for _, tt := range tests {
+		if got := screener.Screen(tt.text).Verdict; got != tt.want {
+			t.Errorf("Screen(%q) = %s, want %s", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	pipeline := Pipeline{
+		NewBannedWords([]string{"scam"}),
+		Links{MaxLinks: 1},
+		Shouting{MaxRepeat: 5, MaxUpperRatio: 0.7, MinLettersUpper: 12},
+	}
+
+	tests := []struct {
+		text        string
+		want        Verdict
+		wantReasons int
+	}{
+		{"A fine kettle", Allow, 0},
+		{"Buy at www.example.com", Flag, 1},
+		{"THIS SCAM IS AT WWW.EXAMPLE.COM", Reject, 3},
+	}
+
+	for _, tt := range tests {
+		got := pipeline.Screen(tt.text)
+		if got.Verdict != tt.want || len(got.Reasons) != tt.wantReasons {
+			t.Errorf("Screen(%q) = %s with reasons %q, want %s with %d reasons", tt.text, got.Verdict, got.Reasons, tt.want, tt.wantReasons)
+		}
+	}
+
+	if got := (Pipeline{}).Screen("anything"); got.Verdict != Allow || got.Summary() != "" {
+		t.Errorf("empty pipeline = %+v, want allow", got)
+	}
+}
+
+func TestSummary(t *testing.T) {
+	result := Result{Verdict: Flag, Reasons: []string{"contains a link", "is written mostly in capitals"}}
+	if got, want := result.Summary(), "contains a link; is written mostly in capitals"; got != want {
+		t.Errorf("Summary() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,274 @@
+// Package sentiment scores how positive or negative a text is, with a
+// lexicon of word, emoticon and emoji valences and a few rules for
+// negation, intensifiers and contrast in the style of VADER.
+package sentiment
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+//go:embed lexicon.txt
+var bundledLexicon string
+
+// Label sums up a score
+type Label string
+
+const (
+	Positive Label = "positive"
+	Neutral  Label = "neutral"
+	Negative Label = "negative"
+)
+
+// Labels lists every label
+var Labels = []Label{Positive, Neutral, Negative}
+
+// Scores between -threshold and threshold are neutral
+const threshold = 0.05
+
+// Result is the sentiment of a text: a score from -1 (most negative) to 1
+// (most positive) and its label
+type Result struct {
+	Score float64
+	Label Label
+}
+
+// Words that flip the valence of the words following them
+var negations = map[string]bool{
+	"not": true, "no": true, "never": true, "none": true, "nothing": true,
+	"nobody": true, "neither": true, "nor": true, "without": true, "hardly": true,
+	"cannot": true, "can't": true, "cant": true, "don't": true, "dont": true,
+	"doesn't": true, "doesnt": true, "didn't": true, "didnt": true,
+	"isn't": true, "isnt": true, "wasn't": true, "wasnt": true,
+	"aren't": true, "arent": true, "weren't": true, "werent": true,
+	"won't": true, "wont": true, "wouldn't": true, "wouldnt": true,
+	"shouldn't": true, "shouldnt": true, "couldn't": true, "couldnt": true,
+	"hasn't": true, "hasnt": true, "haven't": true, "havent": true,
+	"hadn't": true, "hadnt": true, "ain't": true, "aint": true,
+}
+
+// Words that strengthen (positive) or weaken (negative) the word after
+// them
+var intensifiers = map[string]float64{
+	"absolutely": 0.293, "completely": 0.293, "extremely": 0.293, "highly": 0.293,
+	"incredibly": 0.293, "really": 0.293, "so": 0.293, "super": 0.293,
+	"totally": 0.293, "truly": 0.293, "utterly": 0.293, "very": 0.293,
+	"most": 0.293, "especially": 0.293, "exceptionally": 0.293,
+	"barely": -0.293, "slightly": -0.293, "somewhat": -0.293, "kinda": -0.293,
+	"fairly": -0.293, "marginally": -0.293, "partly": -0.293, "mostly": -0.293,
+}
+
+const (
+	negationFactor = -0.74 // a negated word keeps part of its strength
+	negationWindow = 3     // how many words back a negation reaches
+	capsBoost      = 0.733 // a shouted word in a text that is not all caps
+	exclamationAdd = 0.292 // per exclamation mark, up to 4
+	normalization  = 15    // how fast the sum of valences approaches ±1
+)
+
+// Analyzer scores texts with a lexicon. It is safe for concurrent use.
+type Analyzer struct {
+	lexicon map[string]float64
+}
+
+// New returns an Analyzer using the bundled lexicon
+func New() *Analyzer {
+	lexicon, err := ParseLexicon(bundledLexicon)
+	if err != nil {
+		panic("sentiment: bundled lexicon: " + err.Error())
+	}
+	return &Analyzer{lexicon: lexicon}
+}
+
+// ParseLexicon reads a lexicon made of "token score" lines, skipping
+// empty lines and # comments
+func ParseLexicon(text string) (map[string]float64, error) {
+	lexicon := make(map[string]float64)
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	line := 0
+	for scanner.Scan() {
+		line++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected a token and a score", line)
+		}
+		score, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid score %q", line, fields[1])
+		}
+		lexicon[strings.ToLower(fields[0])] = score
+	}
+	return lexicon, scanner.Err()
+}
+
+// token is a word, emoticon or emoji of a text
+type token struct {
+	text    string // in lower case
+	shouted bool   // written in capitals
+}
+
+// Analyze scores a text
+func (a *Analyzer) Analyze(text string) Result {
+	tokens := a.tokenize(text)
+	shouting := isShouting(text)
+
+	// "but" shifts the weight to what follows it: "the fit is nice but
+	// it broke" is negative
+	but := -1
+	for i, t := range tokens {
+		if t.text == "but" {
+			but = i
+		}
+	}
+
+	sum := 0.0
+	for i, t := range tokens {
+		valence, ok := a.lexicon[t.text]
+		if !ok || valence == 0 {
+			continue
+		}
+
+		if t.shouted && !shouting {
+			valence += math.Copysign(capsBoost, valence)
+		}
+
+		// intensifiers right before the word, weaker further away
+		for back, decay := 1, 1.0; back <= 2 && i-back >= 0; back, decay = back+1, decay*0.95 {
+			if boost, ok := intensifiers[tokens[i-back].text]; ok {
+				if valence > 0 {
+					valence += boost * decay
+				} else {
+					valence -= boost * decay
+				}
+			}
+		}
+
+		for back := 1; back <= negationWindow && i-back >= 0; back++ {
+			if negations[tokens[i-back].text] {
+				valence *= negationFactor
+				break
+			}
+		}
+
+		switch {
+		case but < 0:
+		case i < but:
+			valence *= 0.5
+		case i > but:
+			valence *= 1.5
+		}
+
+		sum += valence
+	}
+
+	if sum != 0 {
+		exclamations := min(strings.Count(text, "!"), 4)
+		sum += math.Copysign(float64(exclamations)*exclamationAdd, sum)
+	}
+
+	score := sum / math.Sqrt(sum*sum+normalization)
+	score = math.Round(score*1000) / 1000
+	return Result{Score: score, Label: LabelFor(score)}
+}
+
+// LabelFor returns the label of a score
+func LabelFor(score float64) Label {
+	switch {
+	case score >= threshold:
+		return Positive
+	case score <= -threshold:
+		return Negative
+	default:
+		return Neutral
+	}
+}
+
+// tokenize splits a text into lower case words, keeping apostrophes and
+// hyphens inside words, and into the emoticons and emoji of the lexicon
+func (a *Analyzer) tokenize(text string) []token {
+	text = strings.ReplaceAll(text, "’", "'")
+
+	var tokens []token
+	for _, field := range strings.Fields(text) {
+		if _, ok := a.lexicon[strings.ToLower(field)]; ok && !isWord(field) {
+			tokens = append(tokens, token{text: strings.ToLower(field)})
+			continue
+		}
+
+		var word []rune
+		flush := func() {
+			w := strings.Trim(string(word), "'-")
+			if w != "" {
+				tokens = append(tokens, token{text: strings.ToLower(w), shouted: isShouted(w)})
+			}
+			word = word[:0]
+		}
+		for _, r := range field {
+			switch {
+			case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '\'' || r == '-':
+				word = append(word, r)
+			case unicode.Is(unicode.Variation_Selector, r) || isSkinTone(r):
+				// part of the emoji before it
+			default:
+				flush()
+				if _, ok := a.lexicon[string(r)]; ok {
+					tokens = append(tokens, token{text: string(r)})
+				}
+			}
+		}
+		flush()
+	}
+	return tokens
+}
+
+// isWord tells whether a field only holds letters
+func isWord(field string) bool {
+	for _, r := range field {
+		if !unicode.IsLetter(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// isShouted tells whether a word of two letters or more is in capitals
+func isShouted(word string) bool {
+	letters := 0
+	for _, r := range word {
+		if unicode.IsLower(r) {
+			return false
+		}
+		if unicode.IsLetter(r) {
+			letters++
+		}
+	}
+	return letters > 1
+}
+
+// isShouting tells whether a whole text is in capitals, in which case
+// no single word stands out
+func isShouting(text string) bool {
+	letters := 0
+	for _, r := range text {
+		if unicode.IsLower(r) {
+			return false
+		}
+		if unicode.IsLetter(r) {
+			letters++
+		}
+	}
+	return letters > 0
+}
+
+// isSkinTone tells whether a rune is an emoji skin tone modifier
+func isSkinTone(r rune) bool {
+	return r >= 0x1F3FB && r <= 0x1F3FF
+}
@@ -0,0 +1,148 @@
+package sentiment
+
+import "testing"
+
+func TestAnalyzeLabels(t *testing.T) {
+	analyzer := New()
+
+	tests := []struct {
+		text string
+		want Label
+	}{
+		{"", Neutral},
+		{"The box is blue", Neutral},
+		{"good", Positive},
+		{"terrible", Negative},
+		{"not good", Negative},
+		{"it isn't bad", Positive},
+		{"I don’t love it", Negative}, // a typographic apostrophe
+		{"not at all good", Negative},
+		{"The color is great but the battery is terrible", Negative},
+		{"The battery is terrible but the color is great", Positive},
+		{"👍", Positive},
+		{"😡", Negative},
+		{"👍🏽", Positive}, // with a skin tone
+		{"love it😀", Positive},
+	}
+
+	for _, tt := range tests {
+		got := analyzer.Analyze(tt.text)
+		if got.Label != tt.want {
+			t.Errorf("Analyze(%q) = %v, want %s", tt.text, got, tt.want)
+		}
+		if got.Score < -1 || got.Score > 1 {
+			t.Errorf("Analyze(%q) score %v is out of range", tt.text, got.Score)
+		}
+	}
+}
+
+func TestAnalyzeScore(t *testing.T) {
+	lexicon, err := ParseLexicon("good 2\nbad -3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	analyzer := &Analyzer{lexicon: lexicon}
+
+	// 2 / sqrt(2² + 15)
+	if got := analyzer.Analyze("good").Score; got != 0.459 {
+		t.Errorf(`Analyze("good") score = %v, want 0.459`, got)
+	}
+	// -0.74 * 2 / sqrt(1.48² + 15)
+	if got := analyzer.Analyze("not good").Score; got != -0.357 {
+		t.Errorf(`Analyze("not good") score = %v, want -0.357`, got)
+	}
+}
+
+func TestAnalyzeRules(t *testing.T) {
+	analyzer := New()
+	score := func(text string) float64 {
+		return analyzer.Analyze(text).Score
+	}
+
+	// each pair is in increasing order of score
+	tests := []struct {
+		name          string
+		lower, higher string
+	}{
+		{"intensifier", "good", "very good"},
+		{"dampener", "slightly good", "good"},
+		{"intensifier two words back", "very good", "very very good"},
+		{"negative intensifier", "extremely bad", "bad"},
+		{"shouted word", "good product", "GOOD product"},
+		{"shouted negative word", "BAD product", "bad product"},
+		{"exclamation", "good", "good!"},
+		{"exclamation on a negative text", "bad!", "bad"},
+		{"negation beyond its window", "not good", "not the kind of good"},
+		{"after but weighs more", "good but bad", "bad but good"},
+		{"before but weighs less", "bad", "bad but fine"},
+	}
+
+	for _, tt := range tests {
+		lower, higher := score(tt.lower), score(tt.higher)
+		if lower >= higher {
+			t.Errorf("%s: score(%q) = %v, want less than score(%q) = %v", tt.name, tt.lower, lower, tt.higher, higher)
+		}
+	}
+
+	// a text all in capitals has no word standing out
+	if got, want := score("GOOD PRODUCT"), score("good product"); got != want {
+		t.Errorf(`score("GOOD PRODUCT") = %v, want %v`, got, want)
+	}
+	// exclamation marks only count up to 4
+	if got, want := score("good!!!!!!"), score("good!!!!"); got != want {
+		t.Errorf(`score("good!!!!!!") = %v, want %v`, got, want)
+	}
+	// exclamation marks alone carry no sentiment
+	if got := score("it arrived!!!"); got != 0 {
+		t.Errorf(`score("it arrived!!!") = %v, want 0`, got)
+	}
+}
+
+func TestLabelFor(t *testing.T) {
+	tests := []struct {
+		score float64
+		want  Label
+	}{
+		{1, Positive},
+		{0.05, Positive},
+		{0.049, Neutral},
+		{0, Neutral},
+		{-0.049, Neutral},
+		{-0.05, Negative},
+		{-1, Negative},
+	}
+
+	for _, tt := range tests {
+		if got := LabelFor(tt.score); got != tt.want {
+			t.Errorf("LabelFor(%v) = %s, want %s", tt.score, got, tt.want)
+		}
+	}
+}
+
+func TestParseLexicon(t *testing.T) {
+	lexicon, err := ParseLexicon("# a comment\n\nGood 2\n:) 1.5\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lexicon) != 2 || lexicon["good"] != 2 || lexicon[":)"] != 1.5 {
+		t.Errorf("ParseLexicon = %v, want good 2 and :) 1.5", lexicon)
+	}
+
+	for _, text := range []string{"good", "good 2 3", "good high"} {
+		if _, err := ParseLexicon(text); err == nil {
+			t.Errorf("ParseLexicon(%q) succeeded, want an error", text)
+		}
+	}
+}
+
+func TestBundledLexicon(t *testing.T) {
+	lexicon, err := ParseLexicon(bundledLexicon)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for token, score := range lexicon {
+		if score < -4 || score > 4 {
+			t.Errorf("%q has score %v, want between -4 and 4", token, score)
+		}
+	}
+}
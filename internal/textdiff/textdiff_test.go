@@ -0,0 +1,44 @@
+package textdiff
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWords(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		want     []Op
+	}{
+		{name: "both empty", want: nil},
+		{name: "same text", old: "works well", new: "works  well\n", want: []Op{{Equal, "works well"}}},
+		{name: "new text", new: "works well", want: []Op{{Insert, "works well"}}},
+		{name: "text removed", old: "works well", want: []Op{{Delete, "works well"}}},
+		{
+			name: "word replaced",
+			old:  "the kettle works well",
+			new:  "the kettle broke",
+			want: []Op{{Equal, "the kettle"}, {Delete, "works well"}, {Insert, "broke"}},
+		},
+		{
+			name: "words added in the middle",
+			old:  "boils fast",
+			new:  "boils water very fast",
+			want: []Op{{Equal, "boils"}, {Insert, "water very"}, {Equal, "fast"}},
+		},
+		{
+			name: "case matters",
+			old:  "Great kettle",
+			new:  "great kettle",
+			want: []Op{{Delete, "Great"}, {Insert, "great"}, {Equal, "kettle"}},
+		},
+	}
+
+	for _, tt := range tests {
+		got := Words(tt.old, tt.new)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Words(%q, %q) = %v, want %v", tt.name, tt.old, tt.new, got, tt.want)
+		}
+	}
+}
@@ -1,9 +1,15 @@
 package validator
 
 import (
+	"net/url"
+	"regexp"
 	"slices"
 )
 
+// A simple check of the shape of an email address, as recommended by the
+// WHATWG for HTML email inputs
+var EmailRX = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+\\/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
+
 // We will create a new type named Validator
 type Validator struct {
 	Errors map[string]string
@@ -43,3 +49,14 @@ func (v *Validator) Check(acceptable bool, key string, message string) {
 func PermittedValue(value string, permittedValues ...string) bool {
 	return slices.Contains(permittedValues, value)
 }
+
+// Check that a value is an absolute http or https URL
+func IsURL(value string) bool {
+	u, err := url.Parse(value)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// Check that a value matches a regular expression
+func Matches(value string, rx *regexp.Regexp) bool {
+	return rx.MatchString(value)
+}
@@ -0,0 +1,21 @@
+-- products that share a name and category are merged into the oldest of
+-- them, which takes over the reviews of the others, before the pair is
+-- made unique
+CREATE TEMPORARY TABLE product_duplicates AS
+    SELECT id, kept_id
+    FROM (SELECT id, MIN(id) OVER (PARTITION BY name, category) AS kept_id FROM products) AS p
+    WHERE id <> kept_id;
+
+UPDATE reviews SET product_id = d.kept_id
+FROM product_duplicates d
+WHERE reviews.product_id = d.id;
+
+DELETE FROM products USING product_duplicates d WHERE products.id = d.id;
+
+UPDATE products
+SET average_rating = (SELECT COALESCE(AVG(rating), 0) FROM reviews WHERE reviews.product_id = products.id)
+WHERE id IN (SELECT kept_id FROM product_duplicates);
+
+DROP TABLE product_duplicates;
+
+CREATE UNIQUE INDEX IF NOT EXISTS products_name_category_idx ON products (name, category);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS reviews_status_idx;
+
+ALTER TABLE reviews
+    DROP COLUMN IF EXISTS moderated_at,
+    DROP COLUMN IF EXISTS rejection_reason,
+    DROP COLUMN IF EXISTS status;
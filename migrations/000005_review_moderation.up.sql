@@ -0,0 +1,8 @@
+ALTER TABLE reviews
+    ADD COLUMN status text NOT NULL DEFAULT 'approved'
+        CHECK (status IN ('pending', 'approved', 'rejected')),
+    ADD COLUMN rejection_reason text NOT NULL DEFAULT '',
+    ADD COLUMN moderated_at timestamptz;
+
+-- the moderation queue is read oldest first
+CREATE INDEX IF NOT EXISTS reviews_status_idx ON reviews (status, id);
@@ -0,0 +1,3 @@
+ALTER TABLE reviews
+    DROP COLUMN IF EXISTS screening_reasons,
+    DROP COLUMN IF EXISTS screening_verdict;
@@ -0,0 +1,4 @@
+ALTER TABLE reviews
+    ADD COLUMN screening_verdict text NOT NULL DEFAULT 'allow'
+        CHECK (screening_verdict IN ('allow', 'flag', 'reject')),
+    ADD COLUMN screening_reasons text[] NOT NULL DEFAULT '{}';
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS review_reports;
+
+UPDATE reviews SET status = 'pending' WHERE status = 'hidden';
+ALTER TABLE reviews DROP CONSTRAINT IF EXISTS reviews_status_check;
+ALTER TABLE reviews ADD CONSTRAINT reviews_status_check
+    CHECK (status IN ('pending', 'approved', 'rejected'));
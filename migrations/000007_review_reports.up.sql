@@ -0,0 +1,17 @@
+-- reviews with enough reports are hidden until a moderator looks at them
+ALTER TABLE reviews DROP CONSTRAINT IF EXISTS reviews_status_check;
+ALTER TABLE reviews ADD CONSTRAINT reviews_status_check
+    CHECK (status IN ('pending', 'approved', 'rejected', 'hidden'));
+
+CREATE TABLE IF NOT EXISTS review_reports (
+    id bigserial PRIMARY KEY,
+    review_id integer NOT NULL REFERENCES reviews(id) ON DELETE CASCADE,
+    reporter text NOT NULL,
+    reason text NOT NULL CHECK (reason IN ('spam', 'abusive', 'off_topic', 'fake', 'other')),
+    note text NOT NULL DEFAULT '',
+    resolved boolean NOT NULL DEFAULT false,
+    created_at timestamptz NOT NULL DEFAULT NOW(),
+    UNIQUE (review_id, reporter)
+);
+
+CREATE INDEX IF NOT EXISTS review_reports_unresolved_idx ON review_reports (review_id) WHERE NOT resolved;
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS review_responses (
+    id bigserial PRIMARY KEY,
+    review_id integer NOT NULL UNIQUE REFERENCES reviews(id) ON DELETE CASCADE,
+    author text NOT NULL,
+    content text NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT NOW(),
+    updated_at timestamptz NOT NULL DEFAULT NOW(),
+    version integer NOT NULL DEFAULT 1
+);
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS review_comments (
+    id bigserial PRIMARY KEY,
+    review_id integer NOT NULL REFERENCES reviews(id) ON DELETE CASCADE,
+    parent_id bigint REFERENCES review_comments(id) ON DELETE CASCADE,
+    depth integer NOT NULL DEFAULT 0,
+    content text NOT NULL,
+    status text NOT NULL DEFAULT 'approved'
+        CHECK (status IN ('pending', 'approved', 'rejected')),
+    rejection_reason text NOT NULL DEFAULT '',
+    moderated_at timestamptz,
+    screening_verdict text NOT NULL DEFAULT 'allow'
+        CHECK (screening_verdict IN ('allow', 'flag', 'reject')),
+    screening_reasons text[] NOT NULL DEFAULT '{}',
+    created_at timestamptz NOT NULL DEFAULT NOW(),
+    version integer NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS review_comments_review_idx ON review_comments (review_id, status, id);
+CREATE INDEX IF NOT EXISTS review_comments_parent_idx ON review_comments (parent_id);
+CREATE INDEX IF NOT EXISTS review_comments_status_idx ON review_comments (status, id);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS review_media (
+    id bigserial PRIMARY KEY,
+    review_id integer NOT NULL REFERENCES reviews(id) ON DELETE CASCADE,
+    key text NOT NULL UNIQUE,
+    thumbnail_key text NOT NULL,
+    content_type text NOT NULL,
+    width integer NOT NULL,
+    height integer NOT NULL,
+    size_bytes bigint NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS review_media_review_idx ON review_media (review_id, id);
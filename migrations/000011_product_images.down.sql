@@ -0,0 +1,2 @@
+ALTER TABLE products ALTER COLUMN image_url DROP DEFAULT;
+DROP TABLE IF EXISTS product_images;
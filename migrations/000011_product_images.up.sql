@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS product_images (
+    id bigserial PRIMARY KEY,
+    product_id bigint NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    hash text NOT NULL,
+    original_key text NOT NULL,
+    thumb_key text NOT NULL,
+    medium_key text NOT NULL,
+    large_key text NOT NULL,
+    content_type text NOT NULL,
+    width integer NOT NULL,
+    height integer NOT NULL,
+    size_bytes bigint NOT NULL,
+    position integer NOT NULL,
+    is_primary boolean NOT NULL DEFAULT false,
+    created_at timestamptz NOT NULL DEFAULT NOW(),
+    UNIQUE (product_id, hash)
+);
+
+CREATE INDEX IF NOT EXISTS product_images_product_idx ON product_images (product_id, position);
+CREATE INDEX IF NOT EXISTS product_images_hash_idx ON product_images (hash);
+
+-- a product has at most one primary image
+CREATE UNIQUE INDEX IF NOT EXISTS product_images_primary_idx ON product_images (product_id) WHERE is_primary;
+
+-- uploaded images replace the free-text image_url, which becomes optional
+ALTER TABLE products ALTER COLUMN image_url SET DEFAULT '';
@@ -0,0 +1,2 @@
+ALTER TABLE reviews DROP COLUMN IF EXISTS verified_purchase;
+DROP TABLE IF EXISTS purchases;
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS purchases (
+    id bigserial PRIMARY KEY,
+    product_id bigint NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    email text NOT NULL,
+    order_id text NOT NULL DEFAULT '',
+    purchased_at timestamptz NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT NOW(),
+    -- importing the same order again adds nothing
+    UNIQUE (product_id, email, order_id)
+);
+
+CREATE INDEX IF NOT EXISTS purchases_email_idx ON purchases (email, product_id);
+
+ALTER TABLE reviews ADD COLUMN IF NOT EXISTS verified_purchase boolean NOT NULL DEFAULT false;
@@ -0,0 +1,3 @@
+ALTER TABLE reviews DROP COLUMN IF EXISTS revision_count;
+ALTER TABLE reviews DROP COLUMN IF EXISTS edited_at;
+DROP TABLE IF EXISTS review_revisions;
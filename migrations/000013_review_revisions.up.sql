@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS review_revisions (
+    id bigserial PRIMARY KEY,
+    review_id integer NOT NULL REFERENCES reviews(id) ON DELETE CASCADE,
+    -- the versions of a review are numbered from 1, the current version
+    -- is revision_count + 1
+    revision integer NOT NULL,
+    rating integer NOT NULL,
+    content text NOT NULL,
+    created_at timestamptz NOT NULL,
+    replaced_at timestamptz NOT NULL DEFAULT NOW(),
+    UNIQUE (review_id, revision)
+);
+
+ALTER TABLE reviews ADD COLUMN IF NOT EXISTS edited_at timestamptz;
+ALTER TABLE reviews ADD COLUMN IF NOT EXISTS revision_count integer NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS reviews_sentiment_idx;
+ALTER TABLE reviews DROP COLUMN IF EXISTS sentiment_label;
+ALTER TABLE reviews DROP COLUMN IF EXISTS sentiment_score;
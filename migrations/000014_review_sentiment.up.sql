@@ -0,0 +1,7 @@
+-- left NULL until the review is scored, the backfill command scores the
+-- reviews written before
+ALTER TABLE reviews ADD COLUMN IF NOT EXISTS sentiment_score real;
+ALTER TABLE reviews ADD COLUMN IF NOT EXISTS sentiment_label text
+    CHECK (sentiment_label IN ('positive', 'neutral', 'negative'));
+
+CREATE INDEX IF NOT EXISTS reviews_sentiment_idx ON reviews (product_id, sentiment_label);
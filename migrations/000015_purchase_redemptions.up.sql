@@ -0,0 +1,2 @@
+-- an order verifies a single review
+ALTER TABLE purchases ADD COLUMN IF NOT EXISTS redeemed_at timestamptz;
@@ -0,0 +1 @@
+ALTER TABLE review_revisions DROP COLUMN IF EXISTS status;
@@ -0,0 +1,4 @@
+-- the status of the review when a revision was replaced, readers only
+-- see the content of revisions that were published; it is unknown for
+-- the revisions kept before
+ALTER TABLE review_revisions ADD COLUMN IF NOT EXISTS status text;
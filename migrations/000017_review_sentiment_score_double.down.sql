@@ -0,0 +1 @@
+ALTER TABLE reviews ALTER COLUMN sentiment_score TYPE real;
@@ -0,0 +1,3 @@
+-- the scores are computed as float64, a real column would round them
+-- to single precision when they are stored
+ALTER TABLE reviews ALTER COLUMN sentiment_score TYPE double precision;